@@ -0,0 +1,55 @@
+// Copyright © 2019 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/fusor/cpma/pkg/apply"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// applyCmd applies the generated manifests to an OCP4 cluster
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Applies the generated manifests to an Openshift 4 cluster",
+	Long: `Applies the generated manifests to an Openshift 4 cluster with server-side apply,
+Secrets and ConfigMaps first, using the cluster of the current kubeconfig context`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bindClusterFlags(cmd)
+		if err := env.InitConfig(); err != nil {
+			return err
+		}
+
+		env.InitLogger()
+
+		results, err := apply.Start()
+		if results != nil {
+			apply.PrintSummary(os.Stdout, results)
+		}
+		return err
+	},
+}
+
+func init() {
+	addClusterFlags(applyCmd)
+
+	applyCmd.Flags().Bool("dry-run", false, "have the API server validate the objects without persisting them")
+	env.Config().BindPFlag("DryRun", applyCmd.Flags().Lookup("dry-run"))
+
+	applyCmd.Flags().Bool("force-conflicts", false, "take over fields owned by other managers, such as the installer")
+	env.Config().BindPFlag("ForceConflicts", applyCmd.Flags().Lookup("force-conflicts"))
+}
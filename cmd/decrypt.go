@@ -0,0 +1,53 @@
+// Copyright © 2019 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// decryptCmd restores the secrets encrypted for EncryptionRecipients
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt [path...]",
+	Short: "Restores the encrypted secrets and cached files of the output directory",
+	Long: `Restores the secrets and cached files encrypted for the EncryptionRecipients,
+written with an .asc suffix, next to them and readable by their owner only.
+Paths default to the output directory, which is walked recursively.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := env.InitConfig(); err != nil {
+			return err
+		}
+
+		env.InitLogger()
+
+		restored, err := encrypt.Start(args)
+		for _, file := range restored {
+			fmt.Println(file)
+		}
+		return err
+	},
+}
+
+func init() {
+	decryptCmd.Flags().String("key", "", "OpenPGP private key file of one of the recipients")
+	env.Config().BindPFlag("DecryptionKey", decryptCmd.Flags().Lookup("key"))
+
+	decryptCmd.Flags().String("passphrase-file", "", "file holding the passphrase of the private key")
+	env.Config().BindPFlag("PassphraseFile", decryptCmd.Flags().Lookup("passphrase-file"))
+}
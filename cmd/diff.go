@@ -0,0 +1,50 @@
+// Copyright © 2019 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/fusor/cpma/pkg/apply"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd compares the generated manifests with an OCP4 cluster
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Shows what applying the generated manifests would change on an Openshift 4 cluster",
+	Long: `Shows what applying the generated manifests would change on an Openshift 4 cluster,
+field by field, marking with ! the values owned by the installer or an operator that would be overridden`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bindClusterFlags(cmd)
+		if err := env.InitConfig(); err != nil {
+			return err
+		}
+
+		env.InitLogger()
+
+		diffs, err := apply.StartDiff()
+		if err != nil {
+			return err
+		}
+		apply.PrintDiff(os.Stdout, diffs)
+		return nil
+	},
+}
+
+func init() {
+	addClusterFlags(diffCmd)
+}
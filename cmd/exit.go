@@ -0,0 +1,56 @@
+// Copyright © 2019 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io"
+)
+
+// exitError is a command failure with its exit code
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e exitError) Error() string {
+	if e.err == nil {
+		return "exit status " + strconv.Itoa(e.code)
+	}
+	return e.err.Error()
+}
+
+// exitCode returns the exit code of a command failure, see env.ExitSuccess.
+// Files missing on the cluster are not fetch errors, only unreachable hosts.
+func exitCode(err error) int {
+	if err == nil {
+		return env.ExitSuccess
+	}
+	var e exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	if env.IsConfigError(err) {
+		return env.ExitConfigError
+	}
+	if io.IsUnreachable(err) {
+		return env.ExitFetchError
+	}
+
+	return env.ExitError
+}
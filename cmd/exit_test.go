@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		err              error
+		expectedExitCode int
+	}{
+		{
+			name:             "success",
+			expectedExitCode: env.ExitSuccess,
+		},
+		{
+			name:             "exit error",
+			err:              exitError{err: errors.New("SDN failed"), code: env.ExitPartial},
+			expectedExitCode: env.ExitPartial,
+		},
+		{
+			name:             "wrapped exit error",
+			err:              fmt.Errorf("transform: %w", exitError{err: errors.New("SDN failed"), code: env.ExitPartial}),
+			expectedExitCode: env.ExitPartial,
+		},
+		{
+			name:             "config error",
+			err:              fmt.Errorf("transform: %w", env.ConfigError{Err: errors.New("unknown output format")}),
+			expectedExitCode: env.ExitConfigError,
+		},
+		{
+			name:             "unreachable host",
+			err:              &sftpclient.FetchError{Kind: sftpclient.NetworkError, Host: "master-0", Err: errors.New("connection refused")},
+			expectedExitCode: env.ExitFetchError,
+		},
+		{
+			name:             "other error",
+			err:              errors.New("disk full"),
+			expectedExitCode: env.ExitError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedExitCode, exitCode(tc.err))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright © 2019 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/transform"
+	"github.com/spf13/cobra"
+)
+
+// fetchCmd retrieves the cluster files without transforming them
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "Retrieves the Openshift 3 configuration files the transforms need into the output directory",
+	Long: `Retrieves the Openshift 3 configuration files the transforms need into the output directory,
+without generating anything, so that transform can be run later with --offline`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bindFetchFlags(cmd)
+		if err := env.InitConfig(); err != nil {
+			return err
+		}
+
+		env.InitLogger()
+		defer io.Close()
+
+		results, err := transform.Fetch()
+		if results != nil {
+			transform.PrintFetchSummary(os.Stdout, results)
+		}
+		for _, result := range results {
+			if io.IsUnreachable(result.Err) {
+				return exitError{err: err, code: env.ExitFetchError}
+			}
+		}
+		return err
+	},
+}
+
+func init() {
+	addFetchFlags(fetchCmd)
+}
@@ -16,8 +16,8 @@ package cmd
 
 import (
 	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io"
 	"github.com/fusor/cpma/pkg/report"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -26,14 +26,25 @@ var reportCmd = &cobra.Command{
 	Use:   "report",
 	Short: "Generates a report explaining what Openshift 3 configuration can be recreated on Openshift 4",
 	Long:  "Generates a report explaining what Openshift 3 configuration can be recreated on Openshift 4",
-	Run: func(cmd *cobra.Command, args []string) {
-		err := env.InitConfig()
-		if err != nil {
-			logrus.Fatal(err)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bindFetchFlags(cmd)
+		bindSelectFlags(cmd)
+		if err := env.InitConfig(); err != nil {
+			return err
 		}
 
 		env.InitLogger()
+		defer io.Close()
 
-		report.Start()
+		r, err := report.Start()
+		if err != nil {
+			return err
+		}
+		return r.Write(env.Config().GetString("OutputDir"))
 	},
 }
+
+func init() {
+	addFetchFlags(reportCmd)
+	addSelectFlags(reportCmd)
+}
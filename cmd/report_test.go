@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-report")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	masterConfig, err := ioutil.ReadFile("../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+	cached := filepath.Join(dir, "master-0.test.example.com", "etc", "origin", "master", "master-config.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(cached), 0755))
+	require.NoError(t, ioutil.WriteFile(cached, masterConfig, 0644))
+
+	configFile := filepath.Join(dir, "cpma.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("Source: master-0.test.example.com\nOutputDir: "+dir+"\n"), 0644))
+
+	runCommand := io.RunCommand
+	defer func() { io.RunCommand = runCommand }()
+	io.RunCommand = func(host, command string) ([]byte, error) {
+		t.Errorf("%s run on %s while offline", command, host)
+		return nil, os.ErrNotExist
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	rootCmd.SetArgs([]string{"report", "--config", configFile, "--offline"})
+	require.NoError(t, rootCmd.Execute())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, report.ReportFile))
+	require.NoError(t, err)
+	var r report.Report
+	require.NoError(t, json.Unmarshal(content, &r))
+	assert.Equal(t, "3.11 (master config image format)", r.SourceVersion)
+	assert.Contains(t, r.ReferencedFiles, "/etc/origin/master/front-proxy-ca.crt")
+	assert.Contains(t, r.UnreadConfigs, "/etc/origin/node/node-config.yaml")
+}
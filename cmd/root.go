@@ -16,9 +16,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path"
 
 	"github.com/fusor/cpma/pkg/env"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +35,52 @@ func init() {
 	env.Config().BindPFlag("OutputDir", rootCmd.PersistentFlags().Lookup("output-dir"))
 
 	rootCmd.AddCommand(transformCmd)
+	rootCmd.AddCommand(fetchCmd)
 	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(decryptCmd)
+}
+
+// addFetchFlags adds the flags of commands fetching files from the cluster
+func addFetchFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("workers", 4, "maximum number of transforms to run concurrently")
+	cmd.Flags().Bool("refresh", false, "fetch every file again instead of using local copies")
+	cmd.Flags().Bool("offline", false, "never connect to the cluster, only use local copies")
+	cmd.Flags().Bool("verify", false, "fetch files again when they changed on the cluster since they were fetched")
+}
+
+// bindFetchFlags binds the flags added by addFetchFlags to the configuration.
+// It is done once the command to run is known, as several commands share them.
+func bindFetchFlags(cmd *cobra.Command) {
+	env.Config().BindPFlag("Workers", cmd.Flags().Lookup("workers"))
+	env.Config().BindPFlag("Refresh", cmd.Flags().Lookup("refresh"))
+	env.Config().BindPFlag("Offline", cmd.Flags().Lookup("offline"))
+	env.Config().BindPFlag("Verify", cmd.Flags().Lookup("verify"))
+}
+
+// addSelectFlags adds the flags selecting the transforms to run
+func addSelectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("only", nil, "run only these transforms, see cpma transform list (default all)")
+	cmd.Flags().StringSlice("skip", nil, "do not run these transforms")
+}
+
+// bindSelectFlags binds the flags added by addSelectFlags to the configuration
+func bindSelectFlags(cmd *cobra.Command) {
+	env.Config().BindPFlag("Only", cmd.Flags().Lookup("only"))
+	env.Config().BindPFlag("Skip", cmd.Flags().Lookup("skip"))
+}
+
+// addClusterFlags adds the flags of commands talking to the target cluster
+func addClusterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("kubeconfig", "", "kubeconfig file of the target cluster (default $KUBECONFIG or ~/.kube/config)")
+	cmd.Flags().String("context", "", "kubeconfig context to use (default the current context)")
+}
+
+// bindClusterFlags binds the flags added by addClusterFlags to the configuration
+func bindClusterFlags(cmd *cobra.Command) {
+	env.Config().BindPFlag("Kubeconfig", cmd.Flags().Lookup("kubeconfig"))
+	env.Config().BindPFlag("Context", cmd.Flags().Lookup("context"))
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -41,14 +88,20 @@ var rootCmd = &cobra.Command{
 	Use:   "cpma",
 	Short: "Helps migration cluster configuration of a OCP 3.x cluster to OCP 4.x",
 	Long:  `Helps migration cluster configuration of a OCP 3.x cluster to OCP 4.x`,
+	// Failures are logged by Execute, usage is only shown for --help
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Run cpma --help to see usage.")
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
-// It only needs to happen once.
+// It only needs to happen once. The process exits with the code of the failure,
+// see exitCode.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		logrus.Error(err)
+		os.Exit(exitCode(err))
 	}
 }
@@ -15,9 +15,13 @@
 package cmd
 
 import (
+	"os"
+	"strings"
+
 	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io"
 	"github.com/fusor/cpma/pkg/transform"
-	"github.com/sirupsen/logrus"
+	"github.com/fusor/cpma/pkg/transform/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -26,14 +30,45 @@ var transformCmd = &cobra.Command{
 	Use:   "transform",
 	Short: "Generates configuration from an Openshift 3 cluster for use on an Openshift 4",
 	Long:  "Generates configugation from an Openshift 3 cluster for use on an Openshift 4",
-	Run: func(cmd *cobra.Command, args []string) {
-		err := env.InitConfig()
-		if err != nil {
-			logrus.Fatal(err)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bindFetchFlags(cmd)
+		bindSelectFlags(cmd)
+		if err := env.InitConfig(); err != nil {
+			return err
 		}
 
 		env.InitLogger()
+		defer io.Close()
+
+		summary, err := transform.Start()
+		if summary != nil && summary.ExitCode != env.ExitSuccess {
+			return exitError{err: err, code: summary.ExitCode}
+		}
+		return err
+	},
+}
 
-		transform.Start()
+// transformListCmd prints the transforms --only and --skip select from
+var transformListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the transforms, by the names --only and --skip take",
+	Long:  "Lists the transforms, by the names --only and --skip take, with what they migrate",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return transform.PrintTransforms(os.Stdout)
 	},
 }
+
+func init() {
+	addFetchFlags(transformCmd)
+	addSelectFlags(transformCmd)
+	transformCmd.AddCommand(transformListCmd)
+
+	transformCmd.Flags().String("target-version", "", "OCP4 release to generate manifests for, such as 4.2 (default 4.1)")
+	env.Config().BindPFlag("TargetVersion", transformCmd.Flags().Lookup("target-version"))
+
+	transformCmd.Flags().String("output-format", transform.DefaultOutputFormat, "output format, one of "+strings.Join(transform.OutputFormats(), ", "))
+	env.Config().BindPFlag("OutputFormat", transformCmd.Flags().Lookup("output-format"))
+
+	transformCmd.Flags().String("secrets", secrets.RawStrategy, "how secrets are written, raw Secrets, sealed for SealedSecrets or external for ExternalSecrets")
+	env.Config().BindPFlag("SecretsStrategy", transformCmd.Flags().Lookup("secrets"))
+}
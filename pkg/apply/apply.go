@@ -0,0 +1,283 @@
+package apply
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/redact"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager owns the fields cpma applies on the target cluster
+const FieldManager = "cpma"
+
+// namespacedKinds are the kinds of namespaced objects cpma generates, other
+// objects are cluster wide configuration
+var namespacedKinds = map[string]bool{
+	"ConfigMap":      true,
+	"Secret":         true,
+	"SealedSecret":   true,
+	"ExternalSecret": true,
+}
+
+// Options tells how objects are applied
+type Options struct {
+	// DryRun has the API server validate objects without persisting them
+	DryRun bool
+	// Force takes over fields owned by other managers, such as the installer
+	Force bool
+}
+
+// Object is a manifest to apply
+type Object struct {
+	File       string
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	Content    []byte
+}
+
+// Result is the outcome of applying an object
+type Result struct {
+	Object
+	DryRun bool
+	Err    error
+}
+
+// Start applies the manifests of OutputDir/manifests to the cluster of the
+// configured kubeconfig
+func Start() ([]Result, error) {
+	client, objects, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	return Apply(client, objects, Options{
+		DryRun: env.Config().GetBool("DryRun"),
+		Force:  env.Config().GetBool("ForceConflicts"),
+	})
+}
+
+// load returns a client for the configured kubeconfig and the manifests of
+// OutputDir/manifests
+func load() (*Client, []Object, error) {
+	kubeconfig, err := homedir.Expand(env.Config().GetString("Kubeconfig"))
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := NewClient(kubeconfig, env.Config().GetString("Context"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objects, err := ReadManifests(filepath.Join(env.Config().GetString("OutputDir"), "manifests"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, objects, nil
+}
+
+// ReadManifests reads the manifests of dir, in the order they are applied:
+// Secrets and ConfigMaps before the configuration referring to them, then by
+// file name. Only the files written by the dir output format are read.
+func ReadManifests(dir string) ([]Object, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := filepath.Glob(filepath.Join(dir, "*.yaml"+encrypt.Suffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range encrypted {
+		if _, err := os.Stat(strings.TrimSuffix(file, encrypt.Suffix)); os.IsNotExist(err) {
+			return nil, errors.New(file + " is encrypted, restore it with cpma decrypt first")
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no manifests in " + dir + ", run cpma transform --output-format dir first, the manifests of the other output formats are not read")
+	}
+
+	var objects []Object
+	for _, file := range files {
+		object, err := readObject(file)
+		if err != nil {
+			return nil, errors.New(file + ": " + err.Error())
+		}
+		objects = append(objects, object)
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		if namespacedKinds[objects[i].Kind] != namespacedKinds[objects[j].Kind] {
+			return namespacedKinds[objects[i].Kind]
+		}
+		return objects[i].File < objects[j].File
+	})
+
+	return objects, nil
+}
+
+func readObject(file string) (Object, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Object{}, err
+	}
+	content, err = k8syaml.ToJSON(content)
+	if err != nil {
+		return Object{}, err
+	}
+
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return Object{}, err
+	}
+
+	object := Object{File: filepath.Base(file)}
+	object.APIVersion, _ = manifest["apiVersion"].(string)
+	object.Kind, _ = manifest["kind"].(string)
+	if object.APIVersion == "" || object.Kind == "" {
+		return Object{}, errors.New("missing apiVersion or kind")
+	}
+
+	metadata, _ := manifest["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		manifest["metadata"] = metadata
+	}
+	object.Name, _ = metadata["name"].(string)
+	if object.Name == "" {
+		// Cluster wide configuration objects are all named cluster
+		object.Name = "cluster"
+		metadata["name"] = object.Name
+	}
+	if namespacedKinds[object.Kind] {
+		object.Namespace, _ = metadata["namespace"].(string)
+	} else {
+		delete(metadata, "namespace")
+	}
+
+	object.Content, err = json.Marshal(manifest)
+	return object, err
+}
+
+// Apply applies objects in order as FieldManager, with server-side apply when
+// the cluster supports it. Before OCP 4.3 objects are merged into the live
+// ones instead, with a JSON merge patch, and created if missing: fields are
+// then overridden whoever owns them. Every object is tried, failures being
+// returned in the results.
+func Apply(client *Client, objects []Object, options Options) ([]Result, error) {
+	serverSide, err := client.ServerSideApply()
+	if err != nil {
+		return nil, err
+	}
+	if !serverSide {
+		logrus.Warn("Apply: the cluster does not support server-side apply, merging the objects into the live ones")
+		if options.Force {
+			logrus.Warn("Apply: --force-conflicts has no effect without server-side apply")
+		}
+	}
+
+	var results []Result
+	failed := 0
+	for _, object := range objects {
+		resource, err := client.Resource(object)
+		if err == nil && serverSide {
+			err = applyObject(resource, object, options)
+		} else if err == nil {
+			err = mergeObject(resource, object, options)
+		}
+		if apierrors.IsConflict(err) {
+			err = errors.New("fields owned by another manager, use --force-conflicts to take them over: " + err.Error())
+		}
+		if err != nil {
+			failed++
+			logrus.Warnf("Apply: %s %s: %v", object.Kind, object.Name, err)
+		} else {
+			logrus.Infof("Apply: %s %s applied", object.Kind, object.Name)
+		}
+		results = append(results, Result{Object: object, DryRun: options.DryRun, Err: err})
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d objects failed to apply", failed, len(objects))
+	}
+
+	return results, nil
+}
+
+// applyObject applies object with server-side apply
+func applyObject(resource dynamic.ResourceInterface, object Object, options Options) error {
+	patchOptions := metav1.PatchOptions{FieldManager: FieldManager, DryRun: dryRun(options)}
+	if options.Force {
+		patchOptions.Force = &options.Force
+	}
+
+	_, err := resource.Patch(object.Name, types.ApplyPatchType, object.Content, patchOptions)
+	return err
+}
+
+// mergeObject merges object into the live one, creating it if missing
+func mergeObject(resource dynamic.ResourceInterface, object Object, options Options) error {
+	_, err := resource.Patch(object.Name, types.MergePatchType, object.Content, metav1.PatchOptions{DryRun: dryRun(options)})
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal(object.Content, &content); err != nil {
+		return err
+	}
+	_, err = resource.Create(&unstructured.Unstructured{Object: content}, metav1.CreateOptions{DryRun: dryRun(options)})
+	return err
+}
+
+// dryRun returns the dry run option of requests
+func dryRun(options Options) []string {
+	if options.DryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// Status returns "applied", "applied (dry run)" or the error, masked as it
+// may quote the object
+func (r Result) Status() string {
+	switch {
+	case r.Err != nil:
+		return "failed: " + redact.String(r.Err.Error())
+	case r.DryRun:
+		return "applied (dry run)"
+	default:
+		return "applied"
+	}
+}
+
+// PrintSummary writes a table of the objects applied, in order
+func PrintSummary(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tFILE\tSTATUS")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Kind, result.Namespace, result.Name, result.File, result.Status())
+	}
+	tw.Flush()
+}
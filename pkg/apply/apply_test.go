@@ -0,0 +1,323 @@
+package apply
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// apiResources are the API resources the fake API server serves
+var apiResources = map[string]string{
+	"/api": `{"kind": "APIVersions", "versions": ["v1"]}`,
+	"/apis": `{"kind": "APIGroupList", "apiVersion": "v1", "groups": [
+	{"name": "config.openshift.io", "versions": [{"groupVersion": "config.openshift.io/v1", "version": "v1"}], "preferredVersion": {"groupVersion": "config.openshift.io/v1", "version": "v1"}},
+	{"name": "operator.openshift.io", "versions": [{"groupVersion": "operator.openshift.io/v1", "version": "v1"}], "preferredVersion": {"groupVersion": "operator.openshift.io/v1", "version": "v1"}}
+]}`,
+	"/api/v1": `{"kind": "APIResourceList", "groupVersion": "v1", "resources": [
+	{"name": "configmaps", "namespaced": true, "kind": "ConfigMap", "verbs": ["create", "get", "patch"]},
+	{"name": "secrets", "namespaced": true, "kind": "Secret", "verbs": ["create", "get", "patch"]}
+]}`,
+	"/apis/config.openshift.io/v1": `{"kind": "APIResourceList", "groupVersion": "config.openshift.io/v1", "resources": [
+	{"name": "apiservers", "namespaced": false, "kind": "APIServer", "verbs": ["create", "get", "patch"]},
+	{"name": "oauths", "namespaced": false, "kind": "OAuth", "verbs": ["create", "get", "patch"]}
+]}`,
+	"/apis/operator.openshift.io/v1": `{"kind": "APIResourceList", "groupVersion": "operator.openshift.io/v1", "resources": [
+	{"name": "networks", "namespaced": false, "kind": "Network", "verbs": ["create", "get", "patch"]}
+]}`,
+}
+
+// objectPaths are the API paths of the manifests of testdata, in order
+var objectPaths = []string{
+	"/api/v1/namespaces/openshift-config/configmaps/github-configmap",
+	"/api/v1/namespaces/openshift-config/secrets/htpasswd_auth-secret",
+	"/apis/config.openshift.io/v1/oauths/cluster",
+	"/apis/operator.openshift.io/v1/networks/cluster",
+}
+
+// fakeAPIServer serves discovery and live, and records the other requests,
+// answering a conflict for the objects in conflicts unless forced
+type fakeAPIServer struct {
+	// minor is the Kubernetes minor version of the server
+	minor     string
+	live      map[string]string
+	conflicts map[string]bool
+	mutex     sync.Mutex
+	requests  []string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer secret-token" {
+		writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "Unauthorized")
+		return
+	}
+	if r.URL.Path == "/version" {
+		fmt.Fprintf(w, `{"major": "1", "minor": %q, "gitVersion": "v1.%s"}`, s.minor, strings.TrimSuffix(s.minor, "+"))
+		return
+	}
+	if resources, ok := apiResources[r.URL.Path]; ok {
+		w.Write([]byte(resources))
+		return
+	}
+
+	s.mutex.Lock()
+	request := r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+	if r.Method == http.MethodPatch {
+		request += " " + r.Header.Get("Content-Type")
+	}
+	s.requests = append(s.requests, request)
+	s.mutex.Unlock()
+
+	live, exists := s.live[r.URL.Path]
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && exists:
+		w.Write([]byte(live))
+	case r.Method == http.MethodGet:
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "not found")
+	case r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	case r.Header.Get("Content-Type") == string(types.MergePatchType) && !exists:
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, "not found")
+	case r.Header.Get("Content-Type") == string(types.MergePatchType):
+		w.Write(body)
+	case r.Header.Get("Content-Type") != string(types.ApplyPatchType):
+		writeStatus(w, http.StatusUnsupportedMediaType, metav1.StatusReasonUnsupportedMediaType, "unsupported media type")
+	case s.conflicts[r.URL.Path] && r.URL.Query().Get("force") != "true":
+		writeStatus(w, http.StatusConflict, metav1.StatusReasonConflict, `Apply failed with 1 conflict: conflict with "cluster-version-operator"`)
+	default:
+		w.Write(body)
+	}
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+		Message:  message,
+	})
+}
+
+// newTestClient returns a client of apiServer, served over TLS until the
+// returned function is called
+func newTestClient(t *testing.T, apiServer http.Handler) (*Client, func()) {
+	server := httptest.NewTLSServer(apiServer)
+
+	dir, err := ioutil.TempDir("", "cpma-apply")
+	require.NoError(t, err)
+	cleanup := func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0644))
+	client, err := NewClient(writeKubeconfig(t, dir, server.URL, "ca.crt"), "")
+	if err != nil {
+		cleanup()
+		require.NoError(t, err)
+	}
+
+	return client, cleanup
+}
+
+func writeKubeconfig(t *testing.T, dir, server, caFile string) string {
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: admin
+contexts:
+- name: admin
+  context:
+    cluster: ocp4
+    user: admin
+clusters:
+- name: ocp4
+  cluster:
+    server: ` + server + `
+    certificate-authority: ` + caFile + `
+users:
+- name: admin
+  user:
+    tokenFile: token
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("secret-token"), 0600))
+	path := filepath.Join(dir, "kubeconfig")
+	require.NoError(t, ioutil.WriteFile(path, []byte(kubeconfig), 0600))
+	return path
+}
+
+func TestReadManifests(t *testing.T) {
+	objects, err := ReadManifests("testdata/manifests")
+	require.NoError(t, err)
+
+	var order []string
+	for _, object := range objects {
+		order = append(order, object.Kind+" "+object.Namespace+"/"+object.Name)
+	}
+	assert.Equal(t, []string{
+		"ConfigMap openshift-config/github-configmap",
+		"Secret openshift-config/htpasswd_auth-secret",
+		"OAuth /cluster",
+		"Network /cluster",
+	}, order)
+
+	// Cluster wide objects are named cluster, without namespace
+	var network map[string]interface{}
+	require.NoError(t, json.Unmarshal(objects[3].Content, &network))
+	assert.Equal(t, map[string]interface{}{"name": "cluster"}, network["metadata"])
+	var oauth map[string]interface{}
+	require.NoError(t, json.Unmarshal(objects[2].Content, &oauth))
+	assert.Equal(t, map[string]interface{}{"name": "cluster"}, oauth["metadata"])
+
+	_, err = ReadManifests(filepath.Join("testdata", "missing"))
+	assert.EqualError(t, err, "no manifests in testdata/missing, run cpma transform --output-format dir first, the manifests of the other output formats are not read")
+}
+
+func TestApply(t *testing.T) {
+	objects, err := ReadManifests("testdata/manifests")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		options          Options
+		conflicts        map[string]bool
+		expectedQuery    string
+		expectedStatuses []string
+		expectederr      bool
+	}{
+		{
+			name:             "apply in order",
+			expectedQuery:    "fieldManager=cpma",
+			expectedStatuses: []string{"applied", "applied", "applied", "applied"},
+		},
+		{
+			name:             "dry run",
+			options:          Options{DryRun: true},
+			expectedQuery:    "dryRun=All&fieldManager=cpma",
+			expectedStatuses: []string{"applied (dry run)", "applied (dry run)", "applied (dry run)", "applied (dry run)"},
+		},
+		{
+			name:          "report conflicts",
+			conflicts:     map[string]bool{"/apis/operator.openshift.io/v1/networks/cluster": true},
+			expectedQuery: "fieldManager=cpma",
+			expectedStatuses: []string{"applied", "applied", "applied",
+				`failed: fields owned by another manager, use --force-conflicts to take them over: Apply failed with 1 conflict: conflict with "cluster-version-operator"`},
+			expectederr: true,
+		},
+		{
+			name:             "force conflicts",
+			options:          Options{Force: true},
+			conflicts:        map[string]bool{"/apis/operator.openshift.io/v1/networks/cluster": true},
+			expectedQuery:    "fieldManager=cpma&force=true",
+			expectedStatuses: []string{"applied", "applied", "applied", "applied"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiServer := &fakeAPIServer{minor: "16+", conflicts: tc.conflicts}
+			client, cleanup := newTestClient(t, apiServer)
+			defer cleanup()
+
+			results, err := Apply(client, objects, tc.options)
+			if tc.expectederr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var statuses []string
+			for _, result := range results {
+				statuses = append(statuses, result.Status())
+			}
+			assert.Equal(t, tc.expectedStatuses, statuses)
+
+			var expectedRequests []string
+			for _, path := range objectPaths {
+				expectedRequests = append(expectedRequests, "PATCH "+path+"?"+tc.expectedQuery+" "+string(types.ApplyPatchType))
+			}
+			assert.Equal(t, expectedRequests, apiServer.requests)
+		})
+	}
+}
+
+func TestApplyWithoutServerSideApply(t *testing.T) {
+	objects, err := ReadManifests("testdata/manifests")
+	require.NoError(t, err)
+
+	// OCP 4.2 runs Kubernetes 1.14, only the Secret exists
+	apiServer := &fakeAPIServer{minor: "14+", live: map[string]string{objectPaths[1]: `{"apiVersion": "v1", "kind": "Secret"}`}}
+	client, cleanup := newTestClient(t, apiServer)
+	defer cleanup()
+
+	results, err := Apply(client, objects, Options{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, results, len(objects))
+
+	merge := string(types.MergePatchType)
+	assert.Equal(t, []string{
+		"PATCH " + objectPaths[0] + "?dryRun=All " + merge,
+		"POST /api/v1/namespaces/openshift-config/configmaps?dryRun=All",
+		"PATCH " + objectPaths[1] + "?dryRun=All " + merge,
+		"PATCH " + objectPaths[2] + "?dryRun=All " + merge,
+		"POST /apis/config.openshift.io/v1/oauths?dryRun=All",
+		"PATCH " + objectPaths[3] + "?dryRun=All " + merge,
+		"POST /apis/operator.openshift.io/v1/networks?dryRun=All",
+	}, apiServer.requests)
+}
+
+func TestApplyUnservedKind(t *testing.T) {
+	apiServer := &fakeAPIServer{minor: "16"}
+	client, cleanup := newTestClient(t, apiServer)
+	defer cleanup()
+
+	results, err := Apply(client, []Object{{APIVersion: "config.openshift.io/v1", Kind: "Proxy", Name: "cluster"}}, Options{})
+	require.Error(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].Status(), "failed: kind Proxy of cluster not served by the cluster")
+	assert.Empty(t, apiServer.requests)
+}
+
+func TestNewClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-apply")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	kubeconfig := writeKubeconfig(t, dir, "https://api.ocp4.example.com:6443/", "missing-ca.crt")
+	_, err = NewClient(kubeconfig, "")
+	require.Error(t, err)
+
+	_, err = NewClient(kubeconfig, "other")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "other")
+}
+
+func TestPrintSummary(t *testing.T) {
+	var out strings.Builder
+	PrintSummary(&out, []Result{
+		{Object: Object{Kind: "Secret", Namespace: "openshift-config", Name: "htpasswd_auth-secret", File: "secret.yaml"}},
+		{Object: Object{Kind: "OAuth", Name: "cluster", File: "oauth.yaml"}, DryRun: true},
+	})
+
+	assert.Equal(t, `KIND    NAMESPACE         NAME                  FILE         STATUS
+Secret  openshift-config  htpasswd_auth-secret  secret.yaml  applied
+OAuth                     cluster               oauth.yaml   applied (dry run)
+`, out.String())
+}
@@ -0,0 +1,97 @@
+package apply
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+
+	// The oidc auth provider of kubeconfig files, exec plugins being built in
+	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+)
+
+// serverSideApplyVersion is the first Kubernetes release enabling server-side
+// apply by default, the one of OCP 4.3
+var serverSideApplyVersion = [2]int{1, 16}
+
+// Client talks to the API server of the target cluster
+type Client struct {
+	dynamic   dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	mapper    meta.RESTMapper
+}
+
+// NewClient creates a client for a context of a kubeconfig file, its current
+// context if empty. Without kubeconfig, $KUBECONFIG or ~/.kube/config is read,
+// as with kubectl.
+func NewClient(kubeconfig, context string) (*Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		dynamic:   dynamicClient,
+		discovery: discoveryClient,
+		mapper:    restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
+
+// Resource returns the API resource of object, as the cluster serves it
+func (c *Client) Resource(object Object) (dynamic.ResourceInterface, error) {
+	gv, err := schema.ParseGroupVersion(object.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := c.mapper.RESTMapping(gv.WithKind(object.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return nil, errors.New("kind " + object.Kind + " of " + object.Name + " not served by the cluster: " + err.Error())
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource).Namespace(object.Namespace), nil
+	}
+	return c.dynamic.Resource(mapping.Resource), nil
+}
+
+// ServerSideApply tells the cluster supports server-side apply
+func (c *Client) ServerSideApply() (bool, error) {
+	info, err := c.discovery.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+
+	// Minor versions of some distributions end with +
+	major, err := strconv.Atoi(strings.TrimSuffix(info.Major, "+"))
+	if err != nil {
+		return false, errors.New("invalid server version " + info.GitVersion)
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(info.Minor, "+"))
+	if err != nil {
+		return false, errors.New("invalid server version " + info.GitVersion)
+	}
+
+	return major > serverSideApplyVersion[0] ||
+		major == serverSideApplyVersion[0] && minor >= serverSideApplyVersion[1], nil
+}
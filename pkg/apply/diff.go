@@ -0,0 +1,258 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/redact"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// keptMetadata are the metadata fields compared, the others being set by the
+// API server or naming the object
+var keptMetadata = map[string]bool{
+	"labels":      true,
+	"annotations": true,
+}
+
+// UntrackedOwner owns the live values of objects whose managers are not
+// tracked, on clusters before OCP 4.3
+const UntrackedOwner = "untracked"
+
+// secretFields hold secret material, never printed
+var secretFields = map[string]bool{
+	"data":       true,
+	"stringData": true,
+}
+
+// Change is a field applying an object would set
+type Change struct {
+	Path string
+	// Live is the value on the cluster, nil if unset
+	Live interface{}
+	// Desired is the value cpma generated
+	Desired interface{}
+	// Owners are the field managers of the live value other than cpma, such
+	// as the installer or an operator
+	Owners []string
+}
+
+// ObjectDiff lists the changes applying an object would make
+type ObjectDiff struct {
+	Object
+	// Exists tells the object is on the cluster already, else it is created
+	Exists  bool
+	Changes []Change
+	Err     error
+}
+
+// StartDiff compares the manifests of OutputDir/manifests with the objects of
+// the cluster of the configured kubeconfig
+func StartDiff() ([]ObjectDiff, error) {
+	client, objects, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(client, objects), nil
+}
+
+// Diff fetches the live version of objects and compares it field by field
+// with the generated one. Only the fields cpma sets are compared, as applying
+// leaves the others alone. Lists are compared as a whole, as they are replaced.
+func Diff(client *Client, objects []Object) []ObjectDiff {
+	var diffs []ObjectDiff
+	for _, object := range objects {
+		diff := ObjectDiff{Object: object}
+
+		// Decoded as live objects are, numbers being integers
+		desired := &unstructured.Unstructured{}
+		diff.Err = desired.UnmarshalJSON(object.Content)
+		var resource dynamic.ResourceInterface
+		if diff.Err == nil {
+			resource, diff.Err = client.Resource(object)
+		}
+		var live *unstructured.Unstructured
+		if diff.Err == nil {
+			live, diff.Err = resource.Get(object.Name, metav1.GetOptions{})
+			diff.Exists = diff.Err == nil
+			if apierrors.IsNotFound(diff.Err) {
+				diff.Err = nil
+			}
+		}
+		if diff.Exists {
+			compare(nil, live.Object, desired.Object, managedFields(live.Object), &diff.Changes)
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs
+}
+
+// compare adds the fields of desired which differ in live to changes, with the
+// managers owning them. Status and the metadata but labels and annotations are
+// not compared.
+func compare(fields []string, live, desired interface{}, managers map[string][]map[string]interface{}, changes *[]Change) {
+	switch {
+	case len(fields) == 1 && fields[0] == "status":
+		return
+	case len(fields) == 2 && fields[0] == "metadata" && !keptMetadata[fields[1]]:
+		return
+	}
+
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		if !reflect.DeepEqual(live, desired) {
+			*changes = append(*changes, Change{Path: strings.Join(fields, "."), Live: live, Desired: desired, Owners: owners(managers, fields, live)})
+		}
+		return
+	}
+
+	liveMap, _ := live.(map[string]interface{})
+	keys := make([]string, 0, len(desiredMap))
+	for key := range desiredMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		compare(append(fields[:len(fields):len(fields)], key), liveMap[key], desiredMap[key], managers, changes)
+	}
+}
+
+// owners returns the managers other than cpma owning the live value of
+// fields, UntrackedOwner if managers are not tracked
+func owners(managers map[string][]map[string]interface{}, fields []string, live interface{}) []string {
+	if live == nil {
+		return nil
+	}
+	if managers == nil {
+		return []string{UntrackedOwner}
+	}
+
+	var owners []string
+	for _, manager := range sortedKeys(managers) {
+		if manager != FieldManager && owns(managers[manager], fields) {
+			owners = append(owners, manager)
+		}
+	}
+
+	return owners
+}
+
+// managedFields returns the fields owned by each manager of live, nil if not
+// tracked. Fields are in the format of managedFields, {"f:spec": {"f:a": {}}},
+// under fieldsV1 since Kubernetes 1.16 and fields before.
+func managedFields(live map[string]interface{}) map[string][]map[string]interface{} {
+	metadata, _ := live["metadata"].(map[string]interface{})
+	entries, _ := metadata["managedFields"].([]interface{})
+	if len(entries) == 0 {
+		return nil
+	}
+
+	managers := make(map[string][]map[string]interface{})
+	for _, entry := range entries {
+		entryMap, _ := entry.(map[string]interface{})
+		manager, _ := entryMap["manager"].(string)
+		fields, ok := entryMap["fieldsV1"].(map[string]interface{})
+		if !ok {
+			fields, _ = entryMap["fields"].(map[string]interface{})
+		}
+		// A manager has an entry per operation, Apply or Update
+		managers[manager] = append(managers[manager], fields)
+	}
+
+	return managers
+}
+
+// owns tells one of the field sets owns the field, or one under it
+func owns(fieldSets []map[string]interface{}, field []string) bool {
+	for _, fields := range fieldSets {
+		owned := true
+		for _, name := range field {
+			fields, owned = fields["f:"+name].(map[string]interface{})
+			if !owned {
+				break
+			}
+		}
+		if owned {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(managers map[string][]map[string]interface{}) []string {
+	keys := make([]string, 0, len(managers))
+	for key := range managers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Override tells the change replaces a value owned by another manager, the
+// installer or an operator
+func (c Change) Override() bool {
+	return len(c.Owners) > 0
+}
+
+// PrintDiff writes the changes of each object. Added fields are marked with
+// +, values owned by another manager that would be overridden with !, other
+// values, applied by cpma before or defaulted, with ~. Secret values are never shown and sensitive
+// values are masked, see redact.String.
+func PrintDiff(w io.Writer, diffs []ObjectDiff) {
+	for _, diff := range diffs {
+		name := diff.Name
+		if diff.Namespace != "" {
+			name = diff.Namespace + "/" + name
+		}
+
+		switch {
+		case diff.Err != nil:
+			fmt.Fprintf(w, "%s %s: %v\n", diff.Kind, name, redact.Error(diff.Err))
+			continue
+		case !diff.Exists:
+			fmt.Fprintf(w, "%s %s: created\n", diff.Kind, name)
+			continue
+		case len(diff.Changes) == 0:
+			fmt.Fprintf(w, "%s %s: unchanged\n", diff.Kind, name)
+			continue
+		default:
+			fmt.Fprintf(w, "%s %s: changed\n", diff.Kind, name)
+		}
+
+		for _, change := range diff.Changes {
+			live, desired := redact.String(printable(change.Live)), redact.String(printable(change.Desired))
+			if diff.Kind == "Secret" && secretFields[strings.SplitN(change.Path, ".", 2)[0]] {
+				live, desired = "<hidden>", "<hidden>"
+			}
+
+			switch {
+			case change.Override():
+				fmt.Fprintf(w, "  ! %s: %s -> %s (owned by %s)\n", change.Path, live, desired, strings.Join(change.Owners, ", "))
+			case change.Live != nil:
+				fmt.Fprintf(w, "  ~ %s: %s -> %s\n", change.Path, live, desired)
+			default:
+				fmt.Fprintf(w, "  + %s: %s\n", change.Path, desired)
+			}
+		}
+	}
+}
+
+func printable(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
@@ -0,0 +1,155 @@
+package apply
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// liveObjects are the objects of the fake cluster, as the API server returns them
+var liveObjects = map[string]string{
+	"/api/v1/namespaces/openshift-config/secrets/htpasswd_auth-secret": `{
+	"apiVersion": "v1",
+	"kind": "Secret",
+	"type": "Opaque",
+	"metadata": {"name": "htpasswd_auth-secret", "namespace": "openshift-config", "uid": "1234", "resourceVersion": "42"},
+	"data": {"htpasswd": "b2xkCg=="}
+}`,
+	"/apis/config.openshift.io/v1/oauths/cluster": `{
+	"apiVersion": "config.openshift.io/v1",
+	"kind": "OAuth",
+	"metadata": {"name": "cluster", "uid": "5678", "generation": 1, "creationTimestamp": "2019-06-01T00:00:00Z"},
+	"spec": {}
+}`,
+	"/apis/operator.openshift.io/v1/networks/cluster": `{
+	"apiVersion": "operator.openshift.io/v1",
+	"kind": "Network",
+	"metadata": {
+		"name": "cluster",
+		"resourceVersion": "1337",
+		"selfLink": "/apis/operator.openshift.io/v1/networks/cluster",
+		"managedFields": [
+			{"manager": "cluster-version-operator", "operation": "Update", "apiVersion": "operator.openshift.io/v1", "fieldsType": "FieldsV1",
+				"fieldsV1": {"f:spec": {".": {}, "f:clusterNetwork": {}, "f:serviceNetwork": {}}}},
+			{"manager": "cluster-network-operator", "operation": "Update", "apiVersion": "operator.openshift.io/v1",
+				"fields": {"f:spec": {"f:serviceNetwork": {}}, "f:status": {"f:clusterNetwork": {}}}},
+			{"manager": "cpma", "operation": "Apply", "apiVersion": "operator.openshift.io/v1", "fieldsType": "FieldsV1",
+				"fieldsV1": {"f:spec": {"f:defaultNetwork": {"f:openshiftSDNConfig": {"f:mode": {}}}}}}
+		]
+	},
+	"spec": {
+		"clusterNetwork": [{"cidr": "10.128.0.0/14", "hostPrefix": 23}],
+		"serviceNetwork": ["172.30.0.0/16"],
+		"defaultNetwork": {"type": "OpenShiftSDN", "openshiftSDNConfig": {"mode": "NetworkPolicy"}}
+	},
+	"status": {"clusterNetwork": [{"cidr": "10.128.0.0/14", "hostPrefix": 23}]}
+}`,
+}
+
+func TestDiff(t *testing.T) {
+	objects, err := ReadManifests("testdata/manifests")
+	require.NoError(t, err)
+
+	client, cleanup := newTestClient(t, &fakeAPIServer{minor: "16", live: liveObjects})
+	defer cleanup()
+
+	diffs := Diff(client, objects)
+	require.Len(t, diffs, len(objects))
+
+	// The ConfigMap is missing from the cluster
+	assert.False(t, diffs[0].Exists)
+	assert.NoError(t, diffs[0].Err)
+
+	// Server fields are ignored, values owned by other managers overridden
+	network := diffs[3]
+	assert.True(t, network.Exists)
+	assert.Equal(t, []Change{
+		{
+			Path:    "spec.clusterNetwork",
+			Live:    []interface{}{map[string]interface{}{"cidr": "10.128.0.0/14", "hostPrefix": int64(23)}},
+			Desired: []interface{}{map[string]interface{}{"cidr": "10.128.0.0/14", "hostPrefix": int64(9)}},
+			Owners:  []string{"cluster-version-operator"},
+		},
+		{
+			Path:    "spec.defaultNetwork.openshiftSDNConfig.mode",
+			Live:    "NetworkPolicy",
+			Desired: "Subnet",
+		},
+		{
+			Path:    "spec.serviceNetwork",
+			Live:    []interface{}{"172.30.0.0/16"},
+			Desired: "172.30.0.0/16",
+			Owners:  []string{"cluster-network-operator", "cluster-version-operator"},
+		},
+	}, network.Changes)
+	assert.False(t, network.Changes[1].Override())
+
+	var out strings.Builder
+	PrintDiff(&out, diffs)
+	assert.Equal(t, `ConfigMap openshift-config/github-configmap: created
+Secret openshift-config/htpasswd_auth-secret: changed
+  ! data.htpasswd: <hidden> -> <hidden> (owned by untracked)
+OAuth cluster: changed
+  + spec.identityProviders: [{"challenge":true,"htpasswd":{"fileData":{"name":"htpasswd_auth-secret"}},"login":true,"mappingMethod":"claim","name":"htpasswd_auth","type":"HTPasswd"}]
+Network cluster: changed
+  ! spec.clusterNetwork: [{"cidr":"10.128.0.0/14","hostPrefix":23}] -> [{"cidr":"10.128.0.0/14","hostPrefix":9}] (owned by cluster-version-operator)
+  ~ spec.defaultNetwork.openshiftSDNConfig.mode: "NetworkPolicy" -> "Subnet"
+  ! spec.serviceNetwork: ["172.30.0.0/16"] -> "172.30.0.0/16" (owned by cluster-network-operator, cluster-version-operator)
+`, out.String())
+}
+
+func TestCompareMetadata(t *testing.T) {
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":              "cluster",
+			"uid":               "1234",
+			"creationTimestamp": "2019-06-01T00:00:00Z",
+			"annotations":       map[string]interface{}{"release.openshift.io/create-only": "true"},
+			"managedFields": []interface{}{map[string]interface{}{
+				"manager":  "cluster-version-operator",
+				"fieldsV1": map[string]interface{}{"f:metadata": map[string]interface{}{"f:annotations": map[string]interface{}{"f:release.openshift.io/create-only": map[string]interface{}{}}}},
+			}},
+		},
+		"status": map[string]interface{}{"ready": true},
+	}
+	desired := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":        "cluster",
+			"uid":         "",
+			"labels":      map[string]interface{}{"app": "cpma"},
+			"annotations": map[string]interface{}{"release.openshift.io/create-only": "false"},
+		},
+		"status": map[string]interface{}{"ready": false},
+	}
+
+	var changes []Change
+	compare(nil, live, desired, managedFields(live), &changes)
+
+	assert.Equal(t, []Change{
+		{
+			Path:    "metadata.annotations.release.openshift.io/create-only",
+			Live:    "true",
+			Desired: "false",
+			Owners:  []string{"cluster-version-operator"},
+		},
+		{
+			Path:    "metadata.labels.app",
+			Desired: "cpma",
+		},
+	}, changes)
+}
+
+func TestPrintDiffUnchanged(t *testing.T) {
+	var out strings.Builder
+	PrintDiff(&out, []ObjectDiff{
+		{Object: Object{Kind: "OAuth", Name: "cluster"}, Exists: true},
+		{Object: Object{Kind: "Network", Name: "cluster"}, Err: apierrors.NewForbidden(schema.GroupResource{Group: "operator.openshift.io", Resource: "networks"}, "cluster", errors.New("no RBAC policy matched"))},
+	})
+
+	assert.Equal(t, "OAuth cluster: unchanged\nNetwork cluster: networks.operator.openshift.io \"cluster\" is forbidden: no RBAC policy matched\n", out.String())
+}
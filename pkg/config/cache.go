@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache holds source documents fetched and decoded once, shared by all
+// transforms. It is safe for concurrent use. An entry is decoded again when
+// its local copy changes, and every file fetched, or which could not be, is
+// recorded for the report.
+type Cache struct {
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	used    map[string]bool
+	failed  map[string]error
+}
+
+type cacheEntry struct {
+	ready   chan struct{}
+	value   interface{}
+	err     error
+	modTime time.Time
+	size    int64
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{
+		entries: make(map[string]*cacheEntry),
+		used:    make(map[string]bool),
+		failed:  make(map[string]error),
+	}
+}
+
+// get returns the cached value for key, calling load if there is none yet or
+// if the file at localPath changed since it was loaded. Concurrent callers for
+// the same key wait for a single load. Failed loads are not cached.
+func (c *Cache) get(key, localPath string, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return load()
+	}
+
+	for {
+		c.mutex.Lock()
+		entry, ok := c.entries[key]
+		if !ok {
+			entry = &cacheEntry{ready: make(chan struct{})}
+			c.entries[key] = entry
+			c.mutex.Unlock()
+
+			entry.value, entry.err = load()
+			entry.modTime, entry.size = stat(localPath)
+			close(entry.ready)
+
+			if entry.err != nil {
+				c.remove(key, entry)
+			}
+			return entry.value, entry.err
+		}
+		c.mutex.Unlock()
+
+		<-entry.ready
+		if entry.err == nil {
+			modTime, size := stat(localPath)
+			if modTime.Equal(entry.modTime) && size == entry.size {
+				return entry.value, nil
+			}
+		}
+		c.remove(key, entry)
+	}
+}
+
+// remove drops entry unless it was already replaced
+func (c *Cache) remove(key string, entry *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+}
+
+// Invalidate drops every cached document
+func (c *Cache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]*cacheEntry)
+}
+
+func (c *Cache) recordUsed(file string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.used[file] = true
+	delete(c.failed, file)
+}
+
+func (c *Cache) recordFailed(file string, err error) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.used[file] {
+		c.failed[file] = err
+	}
+}
+
+// UsedFiles returns the files fetched so far, as <Hostname>:<path>
+func (c *Cache) UsedFiles() []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	files := make([]string, 0, len(c.used))
+	for file := range c.used {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// FailedFiles returns the files which could not be fetched, as
+// <Hostname>:<path>, with the error of the last attempt
+func (c *Cache) FailedFiles() map[string]error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	failed := make(map[string]error, len(c.failed))
+	for file, err := range c.failed {
+		failed[file] = err
+	}
+
+	return failed
+}
+
+// stat returns the modification time and size of a file, zero values if missing
+func stat(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMasterConfig = `apiVersion: v1
+kind: MasterConfig
+networkConfig:
+  serviceNetworkCIDR: 172.30.0.0/16
+`
+
+// fakeGetFile behaves like io.GetFile, reading the local copy if any and
+// "fetching" content otherwise, and counts how often it is called
+func fakeGetFile(calls *int32, content string) func(string, string, string, io.CacheMode) ([]byte, error) {
+	return func(host, src, cacheDir string, mode io.CacheMode) ([]byte, error) {
+		atomic.AddInt32(calls, 1)
+		target := io.LocalPath(cacheDir, src)
+		if f, err := ioutil.ReadFile(target); err == nil {
+			return f, nil
+		}
+		if content == "" {
+			return nil, errors.New("open " + src + ": no such file")
+		}
+
+		os.MkdirAll(path.Dir(target), 0755)
+		if err := ioutil.WriteFile(target, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+}
+
+func TestCacheMasterConfig(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	var calls int32
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = fakeGetFile(&calls, testMasterConfig)
+
+	config := Config{
+		OutputDir:        outputDir,
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		Cache:            NewCache(),
+	}
+
+	t.Run("fetch and decode once for concurrent readers", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				masterConfig, err := config.MasterConfig()
+				assert.NoError(t, err)
+				assert.Equal(t, "172.30.0.0/16", masterConfig.NetworkConfig.ServiceNetworkCIDR)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		assert.Equal(t, []string{"master-0.test.example.com:/etc/origin/master/master-config.yaml"}, config.Cache.UsedFiles())
+	})
+
+	t.Run("decode again when the local copy changes", func(t *testing.T) {
+		local := filepath.Join(outputDir, "master-0.test.example.com", "etc/origin/master/master-config.yaml")
+		changed := []byte("apiVersion: v1\nkind: MasterConfig\nnetworkConfig:\n  serviceNetworkCIDR: 172.31.0.0/16\n# changed\n")
+		require.NoError(t, ioutil.WriteFile(local, changed, 0644))
+
+		masterConfig, err := config.MasterConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "172.31.0.0/16", masterConfig.NetworkConfig.ServiceNetworkCIDR)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("decode again after invalidate", func(t *testing.T) {
+		config.Cache.Invalidate()
+		_, err := config.MasterConfig()
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestCacheDoesNotKeepErrors(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	var calls int32
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = fakeGetFile(&calls, "")
+
+	config := Config{
+		OutputDir:            outputDir,
+		Hostname:             "master-0.test.example.com",
+		RegistriesConfigFile: "/etc/containers/registries.conf",
+		Cache:                NewCache(),
+	}
+
+	_, err = config.Registries()
+	require.Error(t, err)
+	_, err = config.Registries()
+	require.Error(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Empty(t, config.Cache.UsedFiles())
+
+	failed := config.Cache.FailedFiles()
+	assert.Len(t, failed, 1)
+	assert.Error(t, failed["master-0.test.example.com:/etc/containers/registries.conf"])
+}
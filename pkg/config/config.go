@@ -1,11 +1,20 @@
 package config
 
 import (
+	"errors"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/fusor/cpma/pkg/config/decode"
 	"github.com/fusor/cpma/pkg/env"
 	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/redact"
+	"github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	configv1 "github.com/openshift/api/legacyconfig/v1"
 )
 
 // reference:
@@ -13,29 +22,343 @@ import (
 
 // Config contains CPMA configuration information
 type Config struct {
-	OutputDir string
-	Hostname  string
+	OutputDir            string
+	OutputFormat         string
+	Hostname             string
+	MasterConfigFile     string
+	NodeConfigFile       string
+	RegistriesConfigFile string
+	NodeConfigFiles      map[string]string
+	Version              string
+	Target               *Target
+	Workers              int
+	CacheMode            io.CacheMode
+	Cache                *Cache
+	// EncryptionKeys are the public key files of the recipients secrets
+	// written to OutputDir are encrypted for, none to leave them clear
+	EncryptionKeys []string
+	// Secrets tells how the manifests of secrets are generated
+	Secrets SecretsOptions
+	// Only lists the names of the transforms to run, all if empty
+	Only []string
+	// Skip lists the names of the transforms not to run
+	Skip []string
+}
+
+// SecretsOptions configure the secrets strategy, see secrets.NewStrategy
+type SecretsOptions struct {
+	// Strategy is raw, sealed or external, raw if empty
+	Strategy string
+	// Certificate is the PEM file of the public certificate of the sealed
+	// secrets controller
+	Certificate string
+	// Store is the name of the secret store of ExternalSecrets
+	Store string
+	// StoreKind is SecretStore or ClusterSecretStore, the default
+	StoreKind string
+	// Prefix is prepended to the paths of the secrets in the store
+	Prefix string
 }
 
 // Fetch files from the OCP3 cluster
+// Errors are returned as is, see io.IsNotFound and io.IsUnreachable
 func (c *Config) Fetch(path string) ([]byte, error) {
-	dst := filepath.Join(c.OutputDir, c.Hostname, path)
+	return c.fetch(path, func() ([]byte, error) {
+		return io.GetFile(c.Hostname, path, c.cacheDir(), c.CacheMode)
+	})
+}
+
+// FetchSensitive fetches a file holding secrets, such as a private key, whose
+// local copy is protected, see io.GetSensitiveFile
+// Its content is masked in logs and reports, see redact.Register.
+func (c *Config) FetchSensitive(path string) ([]byte, error) {
+	content, err := c.fetch(path, func() ([]byte, error) {
+		return io.GetSensitiveFile(c.Hostname, path, c.cacheDir(), c.CacheMode, c.EncryptionKeys)
+	})
+	if err != nil {
+		return nil, err
+	}
+	redact.Register(string(content))
+
+	return content, nil
+}
+
+func (c *Config) fetch(path string, get func() ([]byte, error)) ([]byte, error) {
+	dst := c.LocalPath(path)
 	logrus.Infof("Fetching file: %s", dst)
-	f, err := io.GetFile(c.Hostname, path, dst)
+	f, err := get()
 	if err != nil {
+		c.Cache.recordFailed(c.Hostname+":"+path, err)
 		return nil, err
 	}
 	logrus.Infof("File:loaded: %v", dst)
+	c.Cache.recordUsed(c.Hostname + ":" + path)
 
 	return f, nil
 }
 
+// MasterConfig returns the decoded master config, fetched once per run.
+// Relative paths are resolved against the master config directory.
+// The result is shared and must not be modified.
+func (c *Config) MasterConfig() (*configv1.MasterConfig, error) {
+	value, err := c.cached("master", c.MasterConfigFile, func(content []byte) (interface{}, error) {
+		registerSensitiveFields(content)
+		masterConfig, err := decode.MasterConfig(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return masterConfig, ResolveMasterConfigPaths(masterConfig, filepath.Dir(c.MasterConfigFile))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*configv1.MasterConfig), nil
+}
+
+// registerSensitiveFields masks the secrets of a config, such as the client
+// secrets of identity providers, in logs and reports
+func registerSensitiveFields(content []byte) {
+	var object interface{}
+	if err := yaml.Unmarshal(content, &object); err != nil {
+		return
+	}
+	redact.RegisterFields(object)
+}
+
+// NodeConfig returns the decoded node config of a node group, fetched once per run.
+// Groups are mapped to files with NodeConfigFiles, others use NodeConfigFile.
+// Relative paths are resolved against the node config directory.
+// The result is shared and must not be modified.
+func (c *Config) NodeConfig(group string) (*configv1.NodeConfig, error) {
+	path, ok := c.NodeConfigFiles[group]
+	if !ok {
+		path = c.NodeConfigFile
+	}
+
+	value, err := c.cached("node", path, func(content []byte) (interface{}, error) {
+		nodeConfig, err := decode.NodeConfig(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return nodeConfig, ResolveNodeConfigPaths(nodeConfig, filepath.Dir(path))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*configv1.NodeConfig), nil
+}
+
+// Registries returns the decoded registries configuration, fetched once per run.
+// The result is shared and must not be modified.
+func (c *Config) Registries() (*decode.RegistriesConfig, error) {
+	value, err := c.cached("registries", c.RegistriesConfigFile, func(content []byte) (interface{}, error) {
+		return decode.Registries(content)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*decode.RegistriesConfig), nil
+}
+
+// ReferenceError is the error the files a config refers to could not be
+// listed with
+type ReferenceError struct {
+	File string
+	Err  error
+}
+
+// ReferenceErrors aggregates the errors of the node configs whose references
+// are missing from ReferencedFiles
+type ReferenceErrors []ReferenceError
+
+// ReferencedFiles lists the files the master config and the node configs
+// refer to, with relative paths resolved against their config directory.
+// The references of node configs which cannot be read are left out, the
+// files listed being returned with ReferenceErrors.
+func (c *Config) ReferencedFiles() ([]string, error) {
+	masterConfig, err := c.MasterConfig()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := MasterConfigReferences(masterConfig)
+	if err != nil {
+		return nil, err
+	}
+	files := refs.Files(filepath.Dir(c.MasterConfigFile))
+
+	groups := []string{""}
+	for group := range c.NodeConfigFiles {
+		groups = append(groups, group)
+	}
+	var errs ReferenceErrors
+	for _, group := range groups {
+		path, ok := c.NodeConfigFiles[group]
+		if !ok {
+			path = c.NodeConfigFile
+		}
+		nodeConfig, err := c.NodeConfig(group)
+		if err != nil {
+			errs = append(errs, ReferenceError{File: path, Err: err})
+			continue
+		}
+		files = append(files, NodeConfigReferences(nodeConfig).Files(filepath.Dir(path))...)
+	}
+
+	seen := make(map[string]bool)
+	unique := files[:0]
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			unique = append(unique, file)
+		}
+	}
+	sort.Strings(unique)
+
+	if len(errs) > 0 {
+		return unique, errs
+	}
+	return unique, nil
+}
+
+// FetchReferencedFiles fetches every file of ReferencedFiles, those holding
+// secrets, see SensitiveFile, with FetchSensitive. Files which cannot be
+// fetched are recorded in Cache, as with any fetch, and the others still
+// fetched. It returns the files referenced, and ReferenceErrors for the node
+// configs which cannot be read.
+func (c *Config) FetchReferencedFiles() ([]string, error) {
+	files, err := c.ReferencedFiles()
+	var refErrs ReferenceErrors
+	if err != nil && !errors.As(err, &refErrs) {
+		return nil, err
+	}
+
+	for _, file := range files {
+		fetch := c.Fetch
+		if SensitiveFile(file) {
+			fetch = c.FetchSensitive
+		}
+		if _, err := fetch(file); io.IsNotFound(err) {
+			logrus.Infof("Referenced file missing: %v", err)
+		} else if err != nil {
+			logrus.Warnf("Referenced file not fetched: %v", err)
+		}
+	}
+
+	return files, err
+}
+
+// SensitiveFile tells a referenced file holds secrets: private keys,
+// kubeconfigs holding client keys, htpasswd files and session secrets
+func SensitiveFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, ".key") ||
+		strings.HasSuffix(name, ".kubeconfig") ||
+		strings.Contains(name, "htpasswd") ||
+		strings.Contains(name, "session-secrets")
+}
+
+func (e ReferenceError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e ReferenceErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "references not listed: " + strings.Join(msgs, "; ")
+}
+
+func (c *Config) cached(kind, path string, decodeFunc func([]byte) (interface{}, error)) (interface{}, error) {
+	key := kind + ":" + c.Hostname + ":" + path
+	return c.Cache.get(key, c.LocalPath(path), func() (interface{}, error) {
+		content, err := c.Fetch(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeFunc(content)
+	})
+}
+
+// cacheDir holds the local copies of the files fetched from Hostname
+func (c *Config) cacheDir() string {
+	return filepath.Join(c.OutputDir, c.Hostname)
+}
+
+// LocalPath returns where the local copy of a file of Hostname is kept
+func (c *Config) LocalPath(path string) string {
+	return io.LocalPath(c.cacheDir(), path)
+}
+
 // LoadConfig collects and stores configuration for CPMA
-func LoadConfig() Config {
+// Values are read once so transforms never touch the shared viper
+// configuration while they run concurrently. Failures are env.ConfigErrors.
+func LoadConfig() (Config, error) {
+	cacheMode, err := io.ConfiguredCacheMode()
+	if err != nil {
+		return Config{}, env.ConfigError{Err: err}
+	}
+
+	target, err := NewTarget(env.Config().GetString("TargetVersion"))
+	if err != nil {
+		return Config{}, env.ConfigError{Err: err}
+	}
+
+	encryptionKeys, err := expandPaths(env.Config().GetStringSlice("EncryptionRecipients"))
+	if err != nil {
+		return Config{}, env.ConfigError{Err: err}
+	}
+
+	certificate, err := homedir.Expand(env.Config().GetString("SealedSecretsCertificate"))
+	if err != nil {
+		return Config{}, env.ConfigError{Err: err}
+	}
+
 	logrus.Info("Loaded config")
 
 	return Config{
-		OutputDir: env.Config().GetString("OutputDir"),
-		Hostname:  env.Config().GetString("Source"),
+		OutputDir:            env.Config().GetString("OutputDir"),
+		OutputFormat:         env.Config().GetString("OutputFormat"),
+		Hostname:             env.Config().GetString("Source"),
+		MasterConfigFile:     env.Config().GetString("MasterConfigFile"),
+		NodeConfigFile:       env.Config().GetString("NodeConfigFile"),
+		RegistriesConfigFile: env.Config().GetString("RegistriesConfigFile"),
+		NodeConfigFiles:      env.Config().GetStringMapString("NodeConfigFiles"),
+		Version:              env.Config().GetString("SourceVersion"),
+		Target:               target,
+		Workers:              env.Config().GetInt("Workers"),
+		CacheMode:            cacheMode,
+		Cache:                NewCache(),
+		EncryptionKeys:       encryptionKeys,
+		Secrets: SecretsOptions{
+			Strategy:    env.Config().GetString("SecretsStrategy"),
+			Certificate: certificate,
+			Store:       env.Config().GetString("ExternalSecretStore"),
+			StoreKind:   env.Config().GetString("ExternalSecretStoreKind"),
+			Prefix:      env.Config().GetString("ExternalSecretPrefix"),
+		},
+		Only: env.Config().GetStringSlice("Only"),
+		Skip: env.Config().GetStringSlice("Skip"),
+	}, nil
+}
+
+// expandPaths expands the home directory of paths
+func expandPaths(paths []string) ([]string, error) {
+	expanded := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path, err := homedir.Expand(path)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, path)
 	}
+
+	return expanded, nil
 }
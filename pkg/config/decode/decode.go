@@ -1,6 +1,7 @@
 package decode
 
 import (
+	"github.com/BurntSushi/toml"
 	configv1 "github.com/openshift/api/legacyconfig/v1"
 	k8sjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -36,3 +37,23 @@ func NodeConfig(content []byte) (*configv1.NodeConfig, error) {
 
 	return nodeConfig, nil
 }
+
+// RegistriesConfig holds the registries sections of an OCP3 registries.conf
+type RegistriesConfig struct {
+	Registries map[string]RegistryList `toml:"registries"`
+}
+
+// RegistryList holds a list of registries
+type RegistryList struct {
+	List []string `toml:"registries"`
+}
+
+// Registries unmarshals OCP3 registries.conf
+func Registries(content []byte) (*RegistriesConfig, error) {
+	var registries = new(RegistriesConfig)
+	if _, err := toml.Decode(string(content), registries); err != nil {
+		return nil, err
+	}
+
+	return registries, nil
+}
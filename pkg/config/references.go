@@ -0,0 +1,333 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	configv1 "github.com/openshift/api/legacyconfig/v1"
+)
+
+// ReferenceKind tells what a path in an OCP3 config points to
+type ReferenceKind int
+
+const (
+	// InputFile is a file the component reads, such as a certificate
+	InputFile ReferenceKind = iota
+	// Directory is a directory, such as a data or manifest directory
+	Directory
+	// OutputFile is a file the component writes, such as the audit log
+	OutputFile
+)
+
+// Reference is a path set in an OCP3 config
+type Reference struct {
+	// Field locates the path in the config, e.g. servingInfo.certFile
+	Field string
+	Path  *string
+	Kind  ReferenceKind
+}
+
+// References lists the paths set in an OCP3 config, following OCP3's
+// GetMasterFileReferences and GetNodeFileReferences. Paths are pointers into
+// the config, see Resolve to change them.
+type References struct {
+	Refs []Reference
+	// updates write paths back into identity providers, which are kept raw
+	updates []func() error
+}
+
+func (r *References) add(field string, path *string, kind ReferenceKind) {
+	r.Refs = append(r.Refs, Reference{Field: field, Path: path, Kind: kind})
+}
+
+func (r *References) addCertInfo(field string, certInfo *configv1.CertInfo) {
+	r.add(field+".certFile", &certInfo.CertFile, InputFile)
+	r.add(field+".keyFile", &certInfo.KeyFile, InputFile)
+}
+
+func (r *References) addServingInfo(field string, servingInfo *configv1.ServingInfo) {
+	r.addCertInfo(field, &servingInfo.CertInfo)
+	r.add(field+".clientCA", &servingInfo.ClientCA, InputFile)
+	for i := range servingInfo.NamedCertificates {
+		r.addCertInfo(field+".namedCertificates["+strconv.Itoa(i)+"]", &servingInfo.NamedCertificates[i].CertInfo)
+	}
+}
+
+// addArguments adds the values of arguments named *-file or *-dir
+func (r *References) addArguments(field string, args configv1.ExtendedArguments) {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		kind := InputFile
+		switch {
+		case strings.HasSuffix(name, "-file"):
+		case strings.HasSuffix(name, "-dir"):
+			kind = Directory
+		default:
+			continue
+		}
+
+		values := args[name]
+		for i := range values {
+			r.add(field+"."+name+"["+strconv.Itoa(i)+"]", &values[i], kind)
+		}
+	}
+}
+
+// providerFields lists the path fields of each identity provider kind, fields
+// holding a StringSource being followed by "*"
+var providerFields = map[string][]string{
+	"RequestHeaderIdentityProvider":     {"clientCA"},
+	"HTPasswdPasswordIdentityProvider":  {"file"},
+	"LDAPPasswordIdentityProvider":      {"ca", "bindPassword*"},
+	"BasicAuthPasswordIdentityProvider": {"ca", "certFile", "keyFile"},
+	"KeystonePasswordIdentityProvider":  {"ca", "certFile", "keyFile"},
+	"GitLabIdentityProvider":            {"ca", "clientSecret*"},
+	"OpenIDIdentityProvider":            {"ca", "clientSecret*"},
+	"GoogleIdentityProvider":            {"clientSecret*"},
+	"GitHubIdentityProvider":            {"clientSecret*", "ca"},
+}
+
+// addIdentityProvider adds the paths of a raw identity provider. They are
+// copies, written back to the provider by Resolve.
+func (r *References) addIdentityProvider(field string, identityProvider *configv1.IdentityProvider) error {
+	raw, err := identityProvider.Provider.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var provider map[string]interface{}
+	if err := json.Unmarshal(raw, &provider); err != nil {
+		return err
+	}
+
+	type pathField struct {
+		fields map[string]interface{}
+		name   string
+		path   *string
+	}
+	var pathFields []pathField
+	addField := func(fullName string, fields map[string]interface{}, name string) {
+		path, _ := fields[name].(string)
+		pathFields = append(pathFields, pathField{fields: fields, name: name, path: &path})
+		r.add(fullName, &path, InputFile)
+	}
+
+	kind, _ := provider["kind"].(string)
+	for _, name := range providerFields[kind] {
+		source := strings.TrimSuffix(name, "*")
+		if source == name {
+			addField(field+".provider."+name, provider, name)
+			continue
+		}
+
+		// Only a StringSource object refers to files, not a plain value
+		if fields, ok := provider[source].(map[string]interface{}); ok {
+			addField(field+".provider."+source+".file", fields, "file")
+			addField(field+".provider."+source+".keyFile", fields, "keyFile")
+		}
+	}
+
+	r.updates = append(r.updates, func() error {
+		changed := false
+		for _, f := range pathFields {
+			if old, _ := f.fields[f.name].(string); old != *f.path {
+				f.fields[f.name] = *f.path
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		raw, err := json.Marshal(provider)
+		if err != nil {
+			return err
+		}
+		identityProvider.Provider.Raw = raw
+		identityProvider.Provider.Object = nil
+		return nil
+	})
+
+	return nil
+}
+
+// MasterConfigReferences returns the paths set in a master config
+func MasterConfigReferences(config *configv1.MasterConfig) (*References, error) {
+	r := &References{}
+
+	r.addServingInfo("servingInfo", &config.ServingInfo.ServingInfo)
+
+	r.addCertInfo("etcdClientInfo", &config.EtcdClientInfo.CertInfo)
+	r.add("etcdClientInfo.ca", &config.EtcdClientInfo.CA, InputFile)
+
+	r.addCertInfo("kubeletClientInfo", &config.KubeletClientInfo.CertInfo)
+	r.add("kubeletClientInfo.ca", &config.KubeletClientInfo.CA, InputFile)
+
+	if config.EtcdConfig != nil {
+		r.addServingInfo("etcdConfig.servingInfo", &config.EtcdConfig.ServingInfo)
+		r.addServingInfo("etcdConfig.peerServingInfo", &config.EtcdConfig.PeerServingInfo)
+		r.add("etcdConfig.storageDirectory", &config.EtcdConfig.StorageDir, Directory)
+	}
+
+	if oauthConfig := config.OAuthConfig; oauthConfig != nil {
+		if oauthConfig.MasterCA != nil {
+			r.add("oauthConfig.masterCA", oauthConfig.MasterCA, InputFile)
+		}
+
+		if oauthConfig.SessionConfig != nil {
+			r.add("oauthConfig.sessionConfig.sessionSecretsFile", &oauthConfig.SessionConfig.SessionSecretsFile, InputFile)
+		}
+
+		for i := range oauthConfig.IdentityProviders {
+			field := "oauthConfig.identityProviders[" + oauthConfig.IdentityProviders[i].Name + "]"
+			if err := r.addIdentityProvider(field, &oauthConfig.IdentityProviders[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		if oauthConfig.Templates != nil {
+			r.add("oauthConfig.templates.login", &oauthConfig.Templates.Login, InputFile)
+			r.add("oauthConfig.templates.providerSelection", &oauthConfig.Templates.ProviderSelection, InputFile)
+			r.add("oauthConfig.templates.error", &oauthConfig.Templates.Error, InputFile)
+		}
+	}
+
+	plugins := make([]string, 0, len(config.AdmissionConfig.PluginConfig))
+	for name := range config.AdmissionConfig.PluginConfig {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	for _, name := range plugins {
+		if plugin := config.AdmissionConfig.PluginConfig[name]; plugin != nil {
+			r.add("admissionConfig.pluginConfig["+name+"].location", &plugin.Location, InputFile)
+		}
+	}
+
+	kubernetesMasterConfig := &config.KubernetesMasterConfig
+	r.add("kubernetesMasterConfig.schedulerConfigFile", &kubernetesMasterConfig.SchedulerConfigFile, InputFile)
+	r.addCertInfo("kubernetesMasterConfig.proxyClientInfo", &kubernetesMasterConfig.ProxyClientInfo)
+	r.addArguments("kubernetesMasterConfig.apiServerArguments", kubernetesMasterConfig.APIServerArguments)
+	r.addArguments("kubernetesMasterConfig.schedulerArguments", kubernetesMasterConfig.SchedulerArguments)
+	r.addArguments("kubernetesMasterConfig.controllerArguments", kubernetesMasterConfig.ControllerArguments)
+
+	if config.AuthConfig.RequestHeader != nil {
+		r.add("authConfig.requestHeader.clientCA", &config.AuthConfig.RequestHeader.ClientCA, InputFile)
+	}
+	for i := range config.AuthConfig.WebhookTokenAuthenticators {
+		r.add("authConfig.webhookTokenAuthenticators["+strconv.Itoa(i)+"].configFile",
+			&config.AuthConfig.WebhookTokenAuthenticators[i].ConfigFile, InputFile)
+	}
+	r.add("authConfig.oauthMetadataFile", &config.AuthConfig.OAuthMetadataFile, InputFile)
+
+	r.addCertInfo("aggregatorConfig.proxyClientInfo", &config.AggregatorConfig.ProxyClientInfo)
+
+	r.add("serviceAccountConfig.masterCA", &config.ServiceAccountConfig.MasterCA, InputFile)
+	r.add("serviceAccountConfig.privateKeyFile", &config.ServiceAccountConfig.PrivateKeyFile, InputFile)
+	for i := range config.ServiceAccountConfig.PublicKeyFiles {
+		r.add("serviceAccountConfig.publicKeyFiles["+strconv.Itoa(i)+"]",
+			&config.ServiceAccountConfig.PublicKeyFiles[i], InputFile)
+	}
+
+	r.add("masterClients.openshiftLoopbackKubeConfig", &config.MasterClients.OpenShiftLoopbackKubeConfig, InputFile)
+
+	if signer := config.ControllerConfig.ServiceServingCert.Signer; signer != nil {
+		r.addCertInfo("controllerConfig.serviceServingCert.signer", signer)
+	}
+
+	r.add("auditConfig.auditFilePath", &config.AuditConfig.AuditFilePath, OutputFile)
+	r.add("auditConfig.policyFile", &config.AuditConfig.PolicyFile, InputFile)
+	r.add("auditConfig.webHookKubeConfig", &config.AuditConfig.WebHookKubeConfig, InputFile)
+
+	r.add("imagePolicyConfig.additionalTrustedCA", &config.ImagePolicyConfig.AdditionalTrustedCA, InputFile)
+
+	return r, nil
+}
+
+// NodeConfigReferences returns the paths set in a node config
+func NodeConfigReferences(config *configv1.NodeConfig) *References {
+	r := &References{}
+
+	r.addServingInfo("servingInfo", &config.ServingInfo)
+	r.add("dnsRecursiveResolvConf", &config.DNSRecursiveResolvConf, InputFile)
+	r.add("masterKubeConfig", &config.MasterKubeConfig, InputFile)
+	r.add("volumeDirectory", &config.VolumeDirectory, Directory)
+	if config.PodManifestConfig != nil {
+		r.add("podManifestConfig.path", &config.PodManifestConfig.Path, Directory)
+	}
+	r.addArguments("kubeletArguments", config.KubeletArguments)
+
+	return r
+}
+
+// Files returns the input files referenced, relative paths being resolved
+// against base, the directory of the config file. The list is sorted and
+// has no duplicates.
+func (r *References) Files(base string) []string {
+	seen := make(map[string]bool)
+	var files []string
+
+	for _, ref := range r.Refs {
+		if ref.Kind != InputFile || *ref.Path == "" {
+			continue
+		}
+
+		path := resolvePath(*ref.Path, base)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// Resolve makes every relative path absolute against base, the directory of
+// the config file, as OCP3's ResolvePaths does. Empty paths are left empty.
+func (r *References) Resolve(base string) error {
+	for _, ref := range r.Refs {
+		*ref.Path = resolvePath(*ref.Path, base)
+	}
+
+	for _, update := range r.updates {
+		if err := update(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResolveMasterConfigPaths makes the relative paths of a master config
+// absolute against base, as OCP3's ResolveMasterConfigPaths does
+func ResolveMasterConfigPaths(config *configv1.MasterConfig, base string) error {
+	refs, err := MasterConfigReferences(config)
+	if err != nil {
+		return err
+	}
+
+	return refs.Resolve(base)
+}
+
+// ResolveNodeConfigPaths makes the relative paths of a node config absolute
+// against base, as OCP3's ResolveNodeConfigPaths does
+func ResolveNodeConfigPaths(config *configv1.NodeConfig, base string) error {
+	return NodeConfigReferences(config).Resolve(base)
+}
+
+// resolvePath makes a relative path absolute against base
+func resolvePath(path, base string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(base, path)
+}
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/config/decode"
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMasterConfigReferences(t *testing.T) {
+	content, err := ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+	masterConfig, err := decode.MasterConfig(content)
+	require.NoError(t, err)
+
+	refs, err := MasterConfigReferences(masterConfig)
+	require.NoError(t, err)
+
+	fields := make(map[string]string)
+	for _, ref := range refs.Refs {
+		fields[ref.Field] = *ref.Path
+	}
+	assert.Equal(t, "front-proxy-ca.crt", fields["authConfig.requestHeader.clientCA"])
+	assert.Equal(t, "service-signer.crt", fields["controllerConfig.serviceServingCert.signer.certFile"])
+	assert.Equal(t, "/etc/origin/master/ca.key", fields["kubernetesMasterConfig.controllerArguments.cluster-signing-key-file[0]"])
+	assert.Equal(t, "github.crt", fields["oauthConfig.identityProviders[github123456789].provider.ca"])
+	assert.Equal(t, "/etc/origin/master/htpasswd", fields["oauthConfig.identityProviders[htpasswd_auth].provider.file"])
+
+	assert.Equal(t, []string{
+		"/etc/origin/master/aggregator-front-proxy.crt",
+		"/etc/origin/master/aggregator-front-proxy.key",
+		"/etc/origin/master/ca-bundle.crt",
+		"/etc/origin/master/ca.crt",
+		"/etc/origin/master/ca.key",
+		"/etc/origin/master/front-proxy-ca.crt",
+		"/etc/origin/master/github.crt",
+		"/etc/origin/master/htpasswd",
+		"/etc/origin/master/master.etcd-ca.crt",
+		"/etc/origin/master/master.etcd-client.crt",
+		"/etc/origin/master/master.etcd-client.key",
+		"/etc/origin/master/master.kubelet-client.crt",
+		"/etc/origin/master/master.kubelet-client.key",
+		"/etc/origin/master/master.proxy-client.crt",
+		"/etc/origin/master/master.proxy-client.key",
+		"/etc/origin/master/master.server.crt",
+		"/etc/origin/master/master.server.key",
+		"/etc/origin/master/openshift-master.kubeconfig",
+		"/etc/origin/master/scheduler.json",
+		"/etc/origin/master/service-signer.crt",
+		"/etc/origin/master/service-signer.key",
+		"/etc/origin/master/serviceaccounts.private.key",
+		"/etc/origin/master/serviceaccounts.public.key",
+		"/etc/origin/master/session-secrets.yaml",
+	}, refs.Files("/etc/origin/master"))
+}
+
+func TestNodeConfigReferences(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/node-config.yaml")
+	require.NoError(t, err)
+	nodeConfig, err := decode.NodeConfig(content)
+	require.NoError(t, err)
+
+	refs := NodeConfigReferences(nodeConfig)
+
+	kinds := make(map[string]ReferenceKind)
+	for _, ref := range refs.Refs {
+		kinds[ref.Field] = ref.Kind
+	}
+	assert.Equal(t, Directory, kinds["kubeletArguments.cert-dir[0]"])
+	assert.Equal(t, Directory, kinds["volumeDirectory"])
+	assert.Equal(t, InputFile, kinds["kubeletArguments.client-ca-file[0]"])
+
+	assert.Equal(t, []string{
+		"/etc/origin/node/client-ca.crt",
+		"/etc/origin/node/node.kubeconfig",
+		"/etc/origin/node/resolv.conf",
+		"/etc/origin/node/server.crt",
+		"/etc/origin/node/server.key",
+	}, refs.Files("/etc/origin/node"))
+}
+
+func TestResolveMasterConfigPaths(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "resolve 3.7 master config",
+			config: "../../examples/ocp-3.7/source/etc/origin/master/master-config.yaml",
+		},
+		{
+			name:   "resolve 3.11 master config",
+			config: "../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(tc.config)
+			require.NoError(t, err)
+			masterConfig, err := decode.MasterConfig(content)
+			require.NoError(t, err)
+
+			require.NoError(t, ResolveMasterConfigPaths(masterConfig, "/etc/origin/master"))
+
+			assert.Equal(t, "/etc/origin/master/front-proxy-ca.crt", masterConfig.AuthConfig.RequestHeader.ClientCA)
+			assert.Equal(t, "/etc/origin/master/service-signer.crt", masterConfig.ControllerConfig.ServiceServingCert.Signer.CertFile)
+			assert.Equal(t, "/etc/origin/master/master.server.crt", masterConfig.ServingInfo.CertFile)
+			// Absolute paths are kept
+			assert.Equal(t, "/etc/origin/master/scheduler.json", masterConfig.KubernetesMasterConfig.SchedulerConfigFile)
+
+			refs, err := MasterConfigReferences(masterConfig)
+			require.NoError(t, err)
+			for _, ref := range refs.Refs {
+				if *ref.Path != "" {
+					assert.True(t, filepath.IsAbs(*ref.Path), ref.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveIdentityProviderPaths(t *testing.T) {
+	content, err := ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+	masterConfig, err := decode.MasterConfig(content)
+	require.NoError(t, err)
+
+	require.NoError(t, ResolveMasterConfigPaths(masterConfig, "/etc/origin/master"))
+
+	providers := make(map[string]map[string]interface{})
+	for _, identityProvider := range masterConfig.OAuthConfig.IdentityProviders {
+		provider := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(identityProvider.Provider.Raw, &provider))
+		providers[identityProvider.Name] = provider
+	}
+	assert.Equal(t, "/etc/origin/master/github.crt", providers["github123456789"]["ca"])
+	assert.Equal(t, "/etc/origin/master/htpasswd", providers["htpasswd_auth"]["file"])
+	assert.Equal(t, "GitHubIdentityProvider", providers["github123456789"]["kind"])
+}
+
+func TestResolveNodeConfigPaths(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/node-config.yaml")
+	require.NoError(t, err)
+	nodeConfig, err := decode.NodeConfig(content)
+	require.NoError(t, err)
+
+	require.NoError(t, ResolveNodeConfigPaths(nodeConfig, "/etc/origin/node"))
+
+	refs := NodeConfigReferences(nodeConfig)
+	for _, ref := range refs.Refs {
+		if *ref.Path != "" {
+			assert.True(t, filepath.IsAbs(*ref.Path), ref.Field)
+		}
+	}
+}
+
+func TestMasterConfigResolvesPaths(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-references")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	content, err := ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+
+	var calls int32
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = fakeGetFile(&calls, string(content))
+
+	config := Config{
+		OutputDir:        outputDir,
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		Cache:            NewCache(),
+	}
+
+	masterConfig, err := config.MasterConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/origin/master/front-proxy-ca.crt", masterConfig.AuthConfig.RequestHeader.ClientCA)
+	assert.Contains(t, string(masterConfig.OAuthConfig.IdentityProviders[1].Provider.Raw), `"ca":"/etc/origin/master/github.crt"`)
+}
+
+func TestFetchReferencedFiles(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-references")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	sources := map[string]string{
+		"/etc/origin/master/master-config.yaml": "../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml",
+		"/etc/origin/node/node-config.yaml":     "testdata/node-config.yaml",
+	}
+	var fetched []string
+	getFile := io.GetFile
+	getSensitiveFile := io.GetSensitiveFile
+	defer func() {
+		io.GetFile = getFile
+		io.GetSensitiveFile = getSensitiveFile
+	}()
+	io.GetFile = func(host, src, cacheDir string, mode io.CacheMode) ([]byte, error) {
+		if source, ok := sources[src]; ok {
+			return ioutil.ReadFile(source)
+		}
+		fetched = append(fetched, src)
+		return []byte("certificate"), nil
+	}
+	var sensitive []string
+	io.GetSensitiveFile = func(host, src, cacheDir string, mode io.CacheMode, keyFiles []string) ([]byte, error) {
+		sensitive = append(sensitive, src)
+		return []byte("secret"), nil
+	}
+
+	config := Config{
+		OutputDir:        outputDir,
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		NodeConfigFile:   "/etc/origin/node/node-config.yaml",
+		Cache:            NewCache(),
+	}
+
+	files, err := config.FetchReferencedFiles()
+	require.NoError(t, err)
+
+	assert.Contains(t, files, "/etc/origin/master/front-proxy-ca.crt")
+	assert.Contains(t, files, "/etc/origin/master/htpasswd")
+	assert.Contains(t, files, "/etc/origin/node/server.key")
+	assert.Contains(t, fetched, "/etc/origin/master/front-proxy-ca.crt")
+	assert.Contains(t, fetched, "/etc/origin/node/client-ca.crt")
+	assert.Contains(t, sensitive, "/etc/origin/master/htpasswd")
+	assert.Contains(t, sensitive, "/etc/origin/master/master.server.key")
+	assert.Contains(t, sensitive, "/etc/origin/node/node.kubeconfig")
+	assert.NotContains(t, fetched, "/etc/origin/node/server.key")
+	assert.Len(t, append(fetched, sensitive...), len(files))
+}
+
+func TestReferencedFilesUnreadNodeConfig(t *testing.T) {
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = func(host, src, cacheDir string, mode io.CacheMode) ([]byte, error) {
+		if src == "/etc/origin/master/master-config.yaml" {
+			return ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+		}
+		return nil, errors.New(src + " has no local copy")
+	}
+
+	config := Config{
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		NodeConfigFile:   "/etc/origin/node/node-config.yaml",
+		NodeConfigFiles:  map[string]string{"infra": "/etc/origin/node/infra/node-config.yaml"},
+		Cache:            NewCache(),
+	}
+
+	files, err := config.ReferencedFiles()
+	require.Error(t, err)
+	assert.Contains(t, files, "/etc/origin/master/front-proxy-ca.crt")
+	assert.NotContains(t, files, "/etc/origin/node/server.key")
+
+	refErrs, ok := err.(ReferenceErrors)
+	require.True(t, ok)
+	var unread []string
+	for _, refErr := range refErrs {
+		unread = append(unread, refErr.File)
+	}
+	assert.ElementsMatch(t, []string{"/etc/origin/node/node-config.yaml", "/etc/origin/node/infra/node-config.yaml"}, unread)
+}
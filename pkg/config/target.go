@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Feature is a field of the generated manifests which only some OCP4
+// releases understand
+type Feature string
+
+const (
+	// ImageAllowedRegistries is the Image registrySources.allowedRegistries field
+	ImageAllowedRegistries Feature = "Image spec.registrySources.allowedRegistries"
+	// APIServerEncryption is the APIServer encryption field
+	APIServerEncryption Feature = "APIServer spec.encryption"
+	// APIServerAudit is the APIServer audit profile field
+	APIServerAudit Feature = "APIServer spec.audit"
+	// SchedulerDefaultNodeSelector is the Scheduler defaultNodeSelector field
+	SchedulerDefaultNodeSelector Feature = "Scheduler spec.defaultNodeSelector"
+)
+
+// capabilities is the first OCP4 release understanding each feature.
+// The Network OVN options are not listed: OCP3 only runs OpenShift SDN, so
+// the Network CR never holds them.
+var capabilities = map[Feature]Version{
+	ImageAllowedRegistries:       {Major: 4, Minor: 3},
+	APIServerEncryption:          {Major: 4, Minor: 3},
+	APIServerAudit:               {Major: 4, Minor: 6},
+	SchedulerDefaultNodeSelector: {Major: 4, Minor: 3},
+}
+
+// DefaultTargetVersion is the OCP4 release manifests are generated for when
+// none is given
+var DefaultTargetVersion = Version{Major: 4, Minor: 1}
+
+// Target is the OCP4 release manifests are generated for. It records the
+// features left out of the manifests as the release does not understand them.
+// A nil Target is DefaultTargetVersion. It is safe for concurrent use.
+type Target struct {
+	Version Version
+
+	mutex       sync.Mutex
+	unsupported map[Feature]bool
+}
+
+// NewTarget creates a target for an OCP4 release, given as "4.2"
+func NewTarget(version string) (*Target, error) {
+	if version == "" {
+		return &Target{Version: DefaultTargetVersion}, nil
+	}
+
+	v, err := ParseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if v.Major != 4 || v.Less(DefaultTargetVersion) {
+		return nil, errors.New("unsupported target version " + v.String() + ", needs " + DefaultTargetVersion.String() + " or a later 4.x release")
+	}
+
+	return &Target{Version: v}, nil
+}
+
+// Supports tells whether the target release understands feature. Features it
+// does not are recorded, see Unsupported.
+func (t *Target) Supports(feature Feature) bool {
+	version := DefaultTargetVersion
+	if t != nil {
+		version = t.Version
+	}
+
+	if !version.Less(feature.Since()) {
+		return true
+	}
+
+	if t == nil {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.unsupported == nil {
+		t.unsupported = make(map[Feature]bool)
+	}
+	t.unsupported[feature] = true
+	logrus.Debugf("%s needs OCP %s or later", feature, feature.Since())
+
+	return false
+}
+
+// Unsupported lists the features left out of the manifests so far, sorted
+func (t *Target) Unsupported() []Feature {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var features []Feature
+	for feature := range t.unsupported {
+		features = append(features, feature)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+
+	return features
+}
+
+// Since returns the first OCP4 release understanding the feature
+func (f Feature) Since() Version {
+	return capabilities[f]
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTarget(t *testing.T) {
+	testCases := []struct {
+		name            string
+		version         string
+		expectedVersion Version
+		expectederr     bool
+	}{
+		{
+			name:            "default to the oldest OCP4 release",
+			expectedVersion: DefaultTargetVersion,
+		},
+		{
+			name:            "target a later release",
+			version:         "4.3",
+			expectedVersion: Version{Major: 4, Minor: 3},
+		},
+		{
+			name:        "fail on OCP3 release",
+			version:     "3.11",
+			expectederr: true,
+		},
+		{
+			name:        "fail on release before 4.1",
+			version:     "4.0",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := NewTarget(tc.version)
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersion, target.Version)
+		})
+	}
+}
+
+func TestTargetSupports(t *testing.T) {
+	target, err := NewTarget("4.2")
+	require.NoError(t, err)
+	assert.False(t, target.Supports(APIServerEncryption))
+	assert.False(t, target.Supports(ImageAllowedRegistries))
+	assert.False(t, target.Supports(APIServerEncryption))
+	assert.Equal(t, []Feature{APIServerEncryption, ImageAllowedRegistries}, target.Unsupported())
+
+	target, err = NewTarget("4.3")
+	require.NoError(t, err)
+	assert.True(t, target.Supports(APIServerEncryption))
+	assert.Empty(t, target.Unsupported())
+
+	var defaultTarget *Target
+	assert.False(t, defaultTarget.Supports(APIServerEncryption))
+	assert.Empty(t, defaultTarget.Unsupported())
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/sirupsen/logrus"
+)
+
+// Version is an OpenShift release, such as 3.11
+type Version struct {
+	Major int
+	Minor int
+}
+
+// VersionRange is the inclusive range of releases a transform supports.
+// A zero Max means no upper bound.
+type VersionRange struct {
+	Min Version
+	Max Version
+}
+
+// SourceVersion is the release of the source cluster and how it was detected
+type SourceVersion struct {
+	Version
+	Source string
+}
+
+// versionCommands are run on the master, in order, to tell its release
+var versionCommands = []struct {
+	source  string
+	command string
+}{
+	{source: "openshift version", command: "openshift version"},
+	{source: "rpm", command: "rpm -q --queryformat '%{VERSION}' atomic-openshift"},
+	{source: "rpm", command: "rpm -q --queryformat '%{VERSION}' origin"},
+}
+
+var versionRegexp = regexp.MustCompile(`(?m)^(?:openshift )?v?(\d+)\.(\d+)`)
+
+// ParseVersion reads the release out of a version string, such as "3.11",
+// "v3.11.43" or the output of `openshift version`
+func ParseVersion(s string) (Version, error) {
+	match := versionRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return Version{}, errors.New("invalid OpenShift version " + strconv.Quote(s))
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+
+	return Version{Major: major, Minor: minor}, nil
+}
+
+func (v Version) String() string {
+	if v.IsZero() {
+		return "unknown"
+	}
+
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
+}
+
+// IsZero tells the version is unknown
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Less tells v is an older release than o
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+
+	return v.Minor < o.Minor
+}
+
+// Contains tells v is in the range
+func (r VersionRange) Contains(v Version) bool {
+	return !v.Less(r.Min) && (r.Max.IsZero() || !r.Max.Less(v))
+}
+
+func (r VersionRange) String() string {
+	if r.Max.IsZero() {
+		return r.Min.String() + " or later"
+	}
+	if r.Min == r.Max {
+		return r.Min.String()
+	}
+
+	return r.Min.String() + " to " + r.Max.String()
+}
+
+func (v SourceVersion) String() string {
+	return v.Version.String() + " (" + v.Source + ")"
+}
+
+// SourceVersion returns the release of the source cluster, detected once per
+// run. SourceVersion in the configuration is used as is when set. Otherwise
+// `openshift version` and the RPM database of the master are asked, unless
+// running offline, and the configs are looked at as a last resort.
+func (c *Config) SourceVersion() (SourceVersion, error) {
+	value, err := c.Cache.get("version:"+c.Hostname, "", func() (interface{}, error) {
+		return c.detectVersion()
+	})
+	if err != nil {
+		return SourceVersion{}, err
+	}
+
+	return value.(SourceVersion), nil
+}
+
+func (c *Config) detectVersion() (SourceVersion, error) {
+	if c.Version != "" {
+		version, err := ParseVersion(c.Version)
+		if err != nil {
+			return SourceVersion{}, err
+		}
+		return SourceVersion{Version: version, Source: "configuration"}, nil
+	}
+
+	if c.CacheMode != io.CacheOffline {
+		for _, probe := range versionCommands {
+			output, err := io.RunCommand(c.Hostname, probe.command)
+			if err != nil {
+				logrus.Debugf("Version: %v", err)
+				if io.IsUnreachable(err) {
+					break
+				}
+				continue
+			}
+
+			if version, err := ParseVersion(string(output)); err == nil {
+				return SourceVersion{Version: version, Source: probe.source}, nil
+			}
+		}
+	}
+
+	return c.guessVersion()
+}
+
+// guessVersion tells the release from features of the configs, giving the
+// oldest release having them
+func (c *Config) guessVersion() (SourceVersion, error) {
+	masterConfig, err := c.MasterConfig()
+	if err != nil {
+		return SourceVersion{}, errors.New("unable to detect the source version: " + err.Error())
+	}
+
+	// Images moved to registry.redhat.io with 3.11
+	if strings.HasPrefix(masterConfig.ImageConfig.Format, "registry.redhat.io/") {
+		return SourceVersion{Version: Version{Major: 3, Minor: 11}, Source: "master config image format"}, nil
+	}
+
+	// Nodes bootstrap from ConfigMaps since 3.10
+	if c.NodeConfigFile != "" {
+		if nodeConfig, err := c.NodeConfig(""); err == nil {
+			if _, ok := nodeConfig.KubeletArguments["bootstrap-kubeconfig"]; ok {
+				return SourceVersion{Version: Version{Major: 3, Minor: 10}, Source: "node config bootstrapping"}, nil
+			}
+		}
+	}
+
+	return SourceVersion{}, errors.New("unable to detect the source version, set SourceVersion in the configuration")
+}
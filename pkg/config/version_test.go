@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		name            string
+		input           string
+		expectedVersion Version
+		expectederr     bool
+	}{
+		{
+			name:            "parse release",
+			input:           "3.11",
+			expectedVersion: Version{Major: 3, Minor: 11},
+		},
+		{
+			name:            "parse rpm version",
+			input:           "3.9.74",
+			expectedVersion: Version{Major: 3, Minor: 9},
+		},
+		{
+			name:            "parse openshift version output",
+			input:           "openshift v3.7.72\nkubernetes v1.7.6+a08f5eeb62\netcd 3.2.8\n",
+			expectedVersion: Version{Major: 3, Minor: 7},
+		},
+		{
+			name:        "fail on rpm error",
+			input:       "package origin is not installed",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := ParseVersion(tc.input)
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersion, version)
+		})
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	versions := VersionRange{Min: Version{Major: 3, Minor: 10}, Max: Version{Major: 3, Minor: 11}}
+	assert.False(t, versions.Contains(Version{Major: 3, Minor: 7}))
+	assert.True(t, versions.Contains(Version{Major: 3, Minor: 10}))
+	assert.True(t, versions.Contains(Version{Major: 3, Minor: 11}))
+	assert.False(t, versions.Contains(Version{Major: 4, Minor: 1}))
+	assert.Equal(t, "3.10 to 3.11", versions.String())
+
+	assert.True(t, VersionRange{Min: Version{Major: 3, Minor: 7}}.Contains(Version{Major: 4, Minor: 1}))
+}
+
+func TestSourceVersion(t *testing.T) {
+	content, err := ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+	unreachable := &sftpclient.FetchError{Kind: sftpclient.NetworkError, Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		name            string
+		version         string
+		mode            io.CacheMode
+		outputs         map[string]string
+		commandErr      error
+		expectedVersion SourceVersion
+		expectedruns    int
+	}{
+		{
+			name:            "use configured version",
+			version:         "3.9",
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 9}, Source: "configuration"},
+		},
+		{
+			name:            "ask openshift version",
+			outputs:         map[string]string{"openshift version": "openshift v3.7.72\nkubernetes v1.7.6+a08f5eeb62\n"},
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 7}, Source: "openshift version"},
+			expectedruns:    1,
+		},
+		{
+			name:            "ask rpm",
+			outputs:         map[string]string{"rpm -q --queryformat '%{VERSION}' atomic-openshift": "3.10.45"},
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 10}, Source: "rpm"},
+			expectedruns:    2,
+		},
+		{
+			name:            "guess from config when no command answers",
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 11}, Source: "master config image format"},
+			expectedruns:    3,
+		},
+		{
+			name:            "guess from config when unreachable",
+			commandErr:      unreachable,
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 11}, Source: "master config image format"},
+			expectedruns:    1,
+		},
+		{
+			name:            "guess from config offline",
+			mode:            io.CacheOffline,
+			expectedVersion: SourceVersion{Version: Version{Major: 3, Minor: 11}, Source: "master config image format"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "cpma-version")
+			require.NoError(t, err)
+			defer os.RemoveAll(outputDir)
+
+			var calls int32
+			getFile, runCommand := io.GetFile, io.RunCommand
+			defer func() { io.GetFile, io.RunCommand = getFile, runCommand }()
+			io.GetFile = fakeGetFile(&calls, string(content))
+
+			runs := 0
+			io.RunCommand = func(host, command string) ([]byte, error) {
+				runs++
+				if tc.commandErr != nil {
+					return nil, tc.commandErr
+				}
+				if output, ok := tc.outputs[command]; ok {
+					return []byte(output), nil
+				}
+				return nil, errors.New(command + ": command not found")
+			}
+
+			config := Config{
+				OutputDir:        outputDir,
+				Hostname:         "master-0.test.example.com",
+				MasterConfigFile: "/etc/origin/master/master-config.yaml",
+				Version:          tc.version,
+				CacheMode:        tc.mode,
+				Cache:            NewCache(),
+			}
+
+			version, err := config.SourceVersion()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersion, version)
+			assert.Equal(t, tc.expectedruns, runs)
+
+			// Detected once per run
+			_, err = config.SourceVersion()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedruns, runs)
+		})
+	}
+}
+
+func TestSourceVersionUnknown(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-version")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	content, err := ioutil.ReadFile("../../examples/ocp-3.7/source/etc/origin/master/master-config.yaml")
+	require.NoError(t, err)
+
+	var calls int32
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = fakeGetFile(&calls, string(content))
+
+	config := Config{
+		OutputDir:        outputDir,
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		CacheMode:        io.CacheOffline,
+		Cache:            NewCache(),
+	}
+
+	_, err = config.SourceVersion()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "set SourceVersion in the configuration")
+}
@@ -0,0 +1,258 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	// Hash of keys without hash preferences, which openpgp falls back to
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+// Suffix is appended to the name of encrypted files
+const Suffix = ".asc"
+
+// Encrypter encrypts files for OpenPGP recipients
+type Encrypter struct {
+	recipients openpgp.EntityList
+}
+
+// NewEncrypter creates an encrypter for the public keys of keyFiles, armored
+// or binary. It returns nil when there are no key files, leaving files in
+// clear.
+func NewEncrypter(keyFiles []string) (*Encrypter, error) {
+	if len(keyFiles) == 0 {
+		return nil, nil
+	}
+
+	encrypter := &Encrypter{}
+	for _, keyFile := range keyFiles {
+		keyRing, err := ReadKeyRing(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		encrypter.recipients = append(encrypter.recipients, keyRing...)
+	}
+
+	return encrypter, nil
+}
+
+// ReadKeyRing reads the keys of file, armored or binary
+func ReadKeyRing(file string) (openpgp.EntityList, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyRing openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("-----BEGIN")) {
+		keyRing, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	} else {
+		keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, errors.New(file + ": " + err.Error())
+	}
+	if len(keyRing) == 0 {
+		return nil, errors.New(file + ": no OpenPGP key")
+	}
+
+	return keyRing, nil
+}
+
+// Encrypt returns content encrypted for the recipients, armored
+func (e *Encrypter) Encrypt(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	armored, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openpgp.Encrypt(armored, e.recipients, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := plaintext.Write(content); err != nil {
+		return nil, err
+	}
+	if err := plaintext.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteFile writes sensitive content to file, readable by its owner only.
+// With an encrypter, content is encrypted into file+Suffix instead, and a
+// copy of file in clear is removed.
+func WriteFile(file string, content []byte, encrypter *Encrypter) error {
+	if encrypter == nil {
+		return writeFile(file, content)
+	}
+
+	encrypted, err := encrypter.Encrypt(content)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(file+Suffix, encrypted); err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// writeFile writes content with mode 0600, even to an existing file
+func writeFile(file string, content []byte) error {
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Chmod(file, 0600)
+}
+
+// Decrypter decrypts files encrypted for one of its keys
+type Decrypter struct {
+	keyRing openpgp.EntityList
+}
+
+// NewDecrypter creates a decrypter for the private keys of keyFile, unlocked
+// with passphrase if they are protected
+func NewDecrypter(keyFile string, passphrase []byte) (*Decrypter, error) {
+	keyRing, err := ReadKeyRing(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, entity := range keyRing {
+		keys := []*openpgp.Subkey{{PrivateKey: entity.PrivateKey}}
+		for i := range entity.Subkeys {
+			keys = append(keys, &entity.Subkeys[i])
+		}
+
+		for _, key := range keys {
+			if key.PrivateKey == nil {
+				continue
+			}
+			found = true
+			if !key.PrivateKey.Encrypted {
+				continue
+			}
+			if len(passphrase) == 0 {
+				return nil, errors.New(keyFile + ": private key is protected, a passphrase is needed")
+			}
+			if err := key.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, errors.New(keyFile + ": " + err.Error())
+			}
+		}
+	}
+	if !found {
+		return nil, errors.New(keyFile + ": no private key")
+	}
+
+	return &Decrypter{keyRing: keyRing}, nil
+}
+
+// Decrypt returns the content of an armored encrypted message
+func (d *Decrypter) Decrypt(content []byte) ([]byte, error) {
+	block, err := armor.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := openpgp.ReadMessage(block.Body, d.keyRing, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(message.UnverifiedBody)
+}
+
+// DecryptFiles restores the files encrypted in path, a file or a directory
+// walked recursively, next to their encrypted copy and readable by their owner
+// only. It returns the files restored, stopping at the first failure.
+func (d *Decrypter) DecryptFiles(path string) ([]string, error) {
+	var restored []string
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(file, Suffix) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		content, err = d.Decrypt(content)
+		if err != nil {
+			return errors.New(file + ": " + err.Error())
+		}
+
+		target := strings.TrimSuffix(file, Suffix)
+		if err := writeFile(target, content); err != nil {
+			return err
+		}
+		restored = append(restored, target)
+
+		return nil
+	})
+
+	return restored, err
+}
+
+// Start restores the files encrypted in paths, OutputDir if empty, with the
+// configured private key
+func Start(paths []string) ([]string, error) {
+	keyFile, err := homedir.Expand(env.Config().GetString("DecryptionKey"))
+	if err != nil {
+		return nil, err
+	}
+	if keyFile == "" {
+		return nil, errors.New("no private key to decrypt with, use --key")
+	}
+
+	var passphrase []byte
+	if passphraseFile := env.Config().GetString("PassphraseFile"); passphraseFile != "" {
+		passphrase, err = ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		passphrase = bytes.TrimRight(passphrase, "\r\n")
+	}
+
+	decrypter, err := NewDecrypter(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		paths = []string{env.Config().GetString("OutputDir")}
+	}
+
+	var restored []string
+	for _, path := range paths {
+		files, err := decrypter.DecryptFiles(path)
+		restored = append(restored, files...)
+		if err != nil {
+			return restored, err
+		}
+	}
+
+	return restored, nil
+}
@@ -0,0 +1,115 @@
+package encrypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// writeKeys writes an armored public key and its private key into dir
+func writeKeys(t *testing.T, dir, name string) (string, string) {
+	config := &packet.Config{RSABits: 1024}
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", config)
+	require.NoError(t, err)
+
+	publicKey := filepath.Join(dir, name+".asc")
+	file, err := os.Create(publicKey)
+	require.NoError(t, err)
+	w, err := armor.Encode(file, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	require.NoError(t, file.Close())
+
+	privateKey := filepath.Join(dir, name+".key")
+	file, err = os.Create(privateKey)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(file, config))
+	require.NoError(t, file.Close())
+
+	return publicKey, privateKey
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-encrypt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opsKey, opsPrivateKey := writeKeys(t, dir, "ops")
+	adminKey, adminPrivateKey := writeKeys(t, dir, "admin")
+	_, otherPrivateKey := writeKeys(t, dir, "other")
+
+	encrypter, err := NewEncrypter([]string{opsKey, adminKey})
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(dir, "data", "manifests")
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+	file := filepath.Join(outputDir, "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("stale"), 0644))
+	content := []byte("kind: Secret\ndata:\n  htpasswd: dXNlcjpwYXNzd29yZA==\n")
+	require.NoError(t, WriteFile(file, content, encrypter))
+
+	// Only the encrypted copy is left, readable by its owner only
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	info, err := os.Stat(file + Suffix)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	encrypted, err := ioutil.ReadFile(file + Suffix)
+	require.NoError(t, err)
+	assert.Contains(t, string(encrypted), "-----BEGIN PGP MESSAGE-----")
+	assert.NotContains(t, string(encrypted), "htpasswd")
+
+	// Any recipient can decrypt
+	for _, privateKey := range []string{opsPrivateKey, adminPrivateKey} {
+		decrypter, err := NewDecrypter(privateKey, nil)
+		require.NoError(t, err)
+		restored, err := decrypter.DecryptFiles(filepath.Join(dir, "data"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{file}, restored)
+
+		decrypted, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, content, decrypted)
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	decrypter, err := NewDecrypter(otherPrivateKey, nil)
+	require.NoError(t, err)
+	_, err = decrypter.DecryptFiles(filepath.Join(dir, "data"))
+	assert.Error(t, err)
+
+	_, err = NewDecrypter(opsKey, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no private key")
+}
+
+func TestWriteFileClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-encrypt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "htpasswd")
+	require.NoError(t, ioutil.WriteFile(file, []byte("stale"), 0644))
+	require.NoError(t, WriteFile(file, []byte("user:password"), nil))
+
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "user:password", string(content))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	encrypter, err := NewEncrypter(nil)
+	require.NoError(t, err)
+	assert.Nil(t, encrypter)
+}
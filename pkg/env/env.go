@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/fusor/cpma/pkg/redact"
 	"github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -12,12 +13,12 @@ import (
 const (
 	// AppName holds the name of this application
 	AppName = "CPMA"
+)
 
+var (
 	// logFile - keeps full path to the logging file
 	logFile = "cpma.log.json" // TODO: we may want this configurable
-)
 
-var (
 	// ConfigFile - keeps full path to the configuration file
 	ConfigFile string
 
@@ -33,18 +34,20 @@ func Config() *viper.Viper {
 	return viperConfig
 }
 
-// InitConfig initializes application's configuration
+// InitConfig initializes application's configuration. Failures are
+// ConfigErrors.
 func InitConfig() error {
 	// Find home directory.
 	home, err := homedir.Dir()
 	if err != nil {
-		return errors.New("Can't detect home user directory")
+		return ConfigError{Err: errors.New("Can't detect home user directory")}
 	}
 	viperConfig.Set("home", home)
 
 	viperConfig.SetDefault("MasterConfigFile", "/etc/origin/master/master-config.yaml")
 	viperConfig.SetDefault("NodeConfigFile", "/etc/origin/node/node-config.yaml")
 	viperConfig.SetDefault("RegistriesConfigFile", "/etc/containers/registries.conf")
+	viperConfig.SetDefault("Workers", 4)
 
 	if ConfigFile != "" {
 		viperConfig.SetConfigFile(ConfigFile)
@@ -58,13 +61,14 @@ func InitConfig() error {
 
 	// If a config file is found, read it in.
 	if err := viperConfig.ReadInConfig(); err != nil {
-		return errors.New("Can't read config file")
+		return ConfigError{Err: errors.New("Can't read config file")}
 	}
 
 	return nil
 }
 
-// InitLogger initializes stderr and logger to file
+// InitLogger initializes stderr and logger to file. Sensitive values are
+// masked in both, see redact.Hook.
 func InitLogger() {
 	logLevel := logrus.InfoLevel
 	if viperConfig.GetBool("debug") {
@@ -77,6 +81,9 @@ func InitLogger() {
 		TimestampFormat: time.RFC822,
 	})
 	logrus.SetLevel(logLevel)
+	// The redaction hook must fire before the file hook
+	logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	logrus.AddHook(redact.Hook{})
 	logrus.Debugf("%s is running in debug mode", AppName)
 
 	fileHook, _ := NewLogFileHook(
@@ -0,0 +1,37 @@
+package env
+
+import "errors"
+
+// Exit codes of cpma, for scripts and CI pipelines to tell outcomes apart
+const (
+	// ExitSuccess means everything was done
+	ExitSuccess = 0
+	// ExitError is any failure not classified below
+	ExitError = 1
+	// ExitPartial means the run completed, but some transforms were skipped
+	ExitPartial = 2
+	// ExitConfigError means the configuration could not be read or is invalid
+	ExitConfigError = 3
+	// ExitFetchError means files could not be fetched from the cluster
+	ExitFetchError = 4
+)
+
+// ConfigError is returned when the configuration cannot be read or is invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// IsConfigError tells err is, or wraps, a ConfigError
+func IsConfigError(err error) bool {
+	var configErr ConfigError
+	return errors.As(err, &configErr)
+}
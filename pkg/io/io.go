@@ -1,23 +1,243 @@
 package io
 
 import (
+	"errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
 	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/sirupsen/logrus"
 )
 
-// GetFile first tries to retrieve file from local disk (outputDir/<Hostname>/).
-// If it fails then connects to Hostname to retrieve file and stores it locally
-// To force a network connection remove outputDir/... prior to exec.
-var GetFile = func(host, src, target string) ([]byte, error) {
+// CacheMode is how GetFile treats local copies of fetched files
+type CacheMode string
+
+const (
+	// CacheDefault uses local copies as they are, fetching missing files only
+	CacheDefault CacheMode = ""
+	// CacheRefresh fetches every file again, once per run
+	CacheRefresh CacheMode = "refresh"
+	// CacheOffline never connects, failing on files without a local copy
+	CacheOffline CacheMode = "offline"
+	// CacheVerify fetches a file again when its remote size or modification
+	// time, or its local checksum, differ from the manifest
+	CacheVerify CacheMode = "verify"
+)
+
+var (
+	// fetchFile and statFile reach the hosts, replaced in tests
+	fetchFile = sftpclient.Fetch
+	statFile  = sftpclient.Stat
+
+	// targets locks each local copy while it is checked or fetched, and
+	// remembers the ones already refreshed or verified during the run
+	targets = struct {
+		sync.Mutex
+		states map[string]*targetState
+	}{states: make(map[string]*targetState)}
+)
+
+type targetState struct {
+	sync.Mutex
+	checked bool
+}
+
+// ConfiguredCacheMode returns the cache mode selected by Refresh, Offline or
+// Verify in the configuration
+func ConfiguredCacheMode() (CacheMode, error) {
+	mode := CacheDefault
+	for _, m := range []CacheMode{CacheRefresh, CacheOffline, CacheVerify} {
+		if !env.Config().GetBool(string(m)) {
+			continue
+		}
+		if mode != CacheDefault {
+			return CacheDefault, errors.New("--" + string(mode) + " and --" + string(m) + " cannot be used together")
+		}
+		mode = m
+	}
+
+	return mode, nil
+}
+
+// LocalPath returns where the local copy of src is kept in cacheDir
+func LocalPath(cacheDir, src string) string {
+	return filepath.Join(cacheDir, src)
+}
+
+// GetFile first tries to retrieve file from local disk (cacheDir, that is
+// outputDir/<Hostname>/). If it fails then connects to Hostname to retrieve
+// file and stores it locally, recording it in the cacheDir manifest.
+// mode tells whether local copies can be used as they are, see CacheMode.
+// Fetch failures are returned as *sftpclient.FetchError.
+var GetFile = func(host, src, cacheDir string, mode CacheMode) ([]byte, error) {
+	state := lockTarget(LocalPath(cacheDir, src))
+	defer state.Unlock()
+
+	return getFile(host, src, cacheDir, mode, state, false)
+}
+
+// GetSensitiveFile is GetFile for files holding secrets, such as private keys.
+// The local copy is readable by its owner only and, with the public key files
+// of recipients, only kept encrypted for them, see encrypt.WriteFile: the file
+// is then fetched again on every run, unless restored with cpma decrypt.
+var GetSensitiveFile = func(host, src, cacheDir string, mode CacheMode, keyFiles []string) ([]byte, error) {
+	encrypter, err := encrypt.NewEncrypter(keyFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	target := LocalPath(cacheDir, src)
+	state := lockTarget(target)
+	defer state.Unlock()
+
+	f, err := getFile(host, src, cacheDir, mode, state, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	return f, encrypt.WriteFile(target, f, encrypter)
+}
+
+// lockTarget locks the state of a local copy
+func lockTarget(target string) *targetState {
+	targets.Lock()
+	state, ok := targets.states[target]
+	if !ok {
+		state = &targetState{}
+		targets.states[target] = state
+	}
+	targets.Unlock()
+
+	state.Lock()
+	return state
+}
+
+// getFile is GetFile, the state of the local copy being locked. Sensitive
+// files are not written to the local copy, see fetch.
+func getFile(host, src, cacheDir string, mode CacheMode, state *targetState, sensitive bool) ([]byte, error) {
+	target := LocalPath(cacheDir, src)
 	f, err := ioutil.ReadFile(target)
+	switch {
+	case mode == CacheOffline:
+		if err != nil {
+			if _, err := os.Stat(target + encrypt.Suffix); err == nil {
+				return nil, errors.New(host + ":" + src + " is encrypted in " + cacheDir + ", restore it with cpma decrypt to use it offline")
+			}
+			return nil, errors.New(host + ":" + src + " has no local copy in " + cacheDir + " and cannot be fetched offline")
+		}
+		return f, nil
+	case err == nil && (mode == CacheDefault || state.checked):
+		return f, nil
+	case err == nil && mode == CacheVerify:
+		fresh, err := verify(host, src, cacheDir, f)
+		if err != nil {
+			return nil, err
+		}
+		if fresh {
+			state.checked = true
+			return f, nil
+		}
+		logrus.Infof("Local copy of %s:%s is outdated", host, src)
+	}
+
+	f, err = fetch(host, src, cacheDir, sensitive)
+	if err != nil {
+		return nil, err
+	}
+	state.checked = true
+
+	return f, nil
+}
+
+// fetch retrieves src from host and records it in the manifest. Sensitive
+// files are retrieved into a temporary file readable by its owner only,
+// removed once read, their plaintext never reaching the local copy.
+func fetch(host, src, cacheDir string, sensitive bool) ([]byte, error) {
+	info, err := statFile(host, src)
 	if err != nil {
-		sftpclient.Fetch(host, src, target)
-		netFile, err := ioutil.ReadFile(target)
+		return nil, err
+	}
+
+	target := LocalPath(cacheDir, src)
+	if sensitive {
+		tmpFile, err := ioutil.TempFile("", "cpma-sensitive-")
 		if err != nil {
 			return nil, err
 		}
-		return netFile, nil
+		tmpFile.Close()
+		target = tmpFile.Name()
+		defer os.Remove(target)
+	}
+	if err := fetchFile(host, src, target); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = record(cacheDir, FetchedFile{
+		Host:      host,
+		Path:      src,
+		Size:      info.Size,
+		SHA256:    checksum(f),
+		ModTime:   info.ModTime.UTC(),
+		FetchedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
 	}
+
 	return f, nil
 }
+
+// verify tells whether the local copy of src is still the remote file
+func verify(host, src, cacheDir string, local []byte) (bool, error) {
+	fetched, ok, err := lookup(cacheDir, src)
+	if err != nil {
+		return false, err
+	}
+	if !ok || fetched.SHA256 != checksum(local) {
+		return false, nil
+	}
+
+	info, err := statFile(host, src)
+	if err != nil {
+		return false, err
+	}
+
+	return info.Size == fetched.Size && info.ModTime.Unix() == fetched.ModTime.Unix(), nil
+}
+
+// RunCommand runs command on host and returns its output, replaced in tests.
+// Failures are returned as *sftpclient.FetchError.
+var RunCommand = func(host, command string) ([]byte, error) {
+	return sftpclient.Output(host, command)
+}
+
+// IsNotFound tells err is a file missing on the host
+func IsNotFound(err error) bool {
+	fetchErr, ok := sftpclient.AsFetchError(err)
+	return ok && fetchErr.Kind == sftpclient.NotFoundError
+}
+
+// IsUnreachable tells err is a host which could not be used at all, because of
+// the network, authentication or its host key
+func IsUnreachable(err error) bool {
+	fetchErr, ok := sftpclient.AsFetchError(err)
+	return ok && fetchErr.Unreachable()
+}
+
+// Close releases connections kept open to fetch files
+func Close() {
+	sftpclient.Close()
+}
@@ -0,0 +1,288 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// fakeRemote serves files from a local directory as if it was the host, and
+// counts fetches
+type fakeRemote struct {
+	dir     string
+	fetches int
+	targets []string
+}
+
+func (r *fakeRemote) fetch(host, src, target string) error {
+	r.fetches++
+	r.targets = append(r.targets, target)
+	content, err := ioutil.ReadFile(filepath.Join(r.dir, src))
+	if err != nil {
+		return &sftpclient.FetchError{Kind: sftpclient.NotFoundError, Host: host, Path: src, Err: err}
+	}
+	os.MkdirAll(filepath.Dir(target), 0755)
+	return ioutil.WriteFile(target, content, 0644)
+}
+
+func (r *fakeRemote) stat(host, src string) (sftpclient.FileInfo, error) {
+	info, err := os.Stat(filepath.Join(r.dir, src))
+	if err != nil {
+		return sftpclient.FileInfo{}, &sftpclient.FetchError{Kind: sftpclient.NotFoundError, Host: host, Path: src, Err: err}
+	}
+	return sftpclient.FileInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (r *fakeRemote) write(t *testing.T, src, content string, modTime time.Time) {
+	path := filepath.Join(r.dir, src)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestGetFile(t *testing.T) {
+	const src = "/etc/origin/master/htpasswd"
+	fetched := time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		mode            CacheMode
+		local           bool
+		remoteChanged   bool
+		localChanged    bool
+		expectedContent string
+		expectedFetches int
+		expectederr     bool
+	}{
+		{
+			name:            "fetch missing file",
+			mode:            CacheDefault,
+			expectedContent: "remote",
+			expectedFetches: 1,
+		},
+		{
+			name:            "use local copy",
+			mode:            CacheDefault,
+			local:           true,
+			remoteChanged:   true,
+			expectedContent: "local",
+		},
+		{
+			name:            "refresh local copy",
+			mode:            CacheRefresh,
+			local:           true,
+			expectedContent: "remote",
+			expectedFetches: 1,
+		},
+		{
+			name:            "use local copy offline",
+			mode:            CacheOffline,
+			local:           true,
+			expectedContent: "local",
+		},
+		{
+			name:        "fail offline without local copy",
+			mode:        CacheOffline,
+			expectederr: true,
+		},
+		{
+			name:            "keep verified local copy",
+			mode:            CacheVerify,
+			local:           true,
+			expectedContent: "local",
+		},
+		{
+			name:            "fetch again file changed remotely",
+			mode:            CacheVerify,
+			local:           true,
+			remoteChanged:   true,
+			expectedContent: "remote",
+			expectedFetches: 1,
+		},
+		{
+			name:            "fetch again file changed locally",
+			mode:            CacheVerify,
+			local:           true,
+			localChanged:    true,
+			expectedContent: "local",
+			expectedFetches: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cpma-io")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			remote := &fakeRemote{dir: filepath.Join(dir, "remote")}
+			defaultFetch, defaultStat := fetchFile, statFile
+			defer func() { fetchFile, statFile = defaultFetch, defaultStat }()
+			fetchFile, statFile = remote.fetch, remote.stat
+
+			cacheDir := filepath.Join(dir, "data", "master-0")
+			if tc.local {
+				// A local copy fetched and recorded by an earlier run
+				local := "local"
+				remote.write(t, src, local, fetched)
+				require.NoError(t, os.MkdirAll(filepath.Dir(LocalPath(cacheDir, src)), 0755))
+				require.NoError(t, ioutil.WriteFile(LocalPath(cacheDir, src), []byte(local), 0644))
+				require.NoError(t, record(cacheDir, FetchedFile{
+					Host:    "master-0",
+					Path:    src,
+					Size:    int64(len(local)),
+					SHA256:  checksum([]byte(local)),
+					ModTime: fetched,
+				}))
+				if tc.localChanged {
+					require.NoError(t, ioutil.WriteFile(LocalPath(cacheDir, src), []byte("edited"), 0644))
+				}
+			}
+			if !tc.local || tc.remoteChanged || tc.mode == CacheRefresh {
+				remote.write(t, src, "remote", fetched.Add(time.Hour))
+			}
+
+			content, err := GetFile("master-0", src, cacheDir, tc.mode)
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContent, string(content))
+			assert.Equal(t, tc.expectedFetches, remote.fetches)
+
+			// Once checked, a file is used as is for the rest of the run
+			_, err = GetFile("master-0", src, cacheDir, tc.mode)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFetches, remote.fetches)
+
+			if tc.expectedFetches > 0 {
+				manifest, err := ReadManifest(cacheDir)
+				require.NoError(t, err)
+				file, ok := manifest.Get(src)
+				require.True(t, ok)
+				assert.Equal(t, "master-0", file.Host)
+				assert.Equal(t, int64(len(tc.expectedContent)), file.Size)
+				assert.Equal(t, checksum([]byte(tc.expectedContent)), file.SHA256)
+			}
+		})
+	}
+}
+
+func TestManifestSet(t *testing.T) {
+	manifest := &Manifest{}
+	for _, path := range []string{"/etc/origin/master/master-config.yaml", "/etc/origin/master/ca.crt", "/etc/containers/registries.conf"} {
+		manifest.Set(FetchedFile{Path: path})
+	}
+	manifest.Set(FetchedFile{Path: "/etc/origin/master/ca.crt", Size: 42})
+
+	var paths []string
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{
+		"/etc/containers/registries.conf",
+		"/etc/origin/master/ca.crt",
+		"/etc/origin/master/master-config.yaml",
+	}, paths)
+
+	file, ok := manifest.Get("/etc/origin/master/ca.crt")
+	require.True(t, ok)
+	assert.Equal(t, int64(42), file.Size)
+}
+
+func TestConfiguredCacheMode(t *testing.T) {
+	defer env.Config().Set("Refresh", nil)
+	defer env.Config().Set("Offline", nil)
+
+	env.Config().Set("Offline", true)
+	mode, err := ConfiguredCacheMode()
+	require.NoError(t, err)
+	assert.Equal(t, CacheOffline, mode)
+
+	env.Config().Set("Refresh", true)
+	_, err = ConfiguredCacheMode()
+	assert.Error(t, err)
+}
+
+// writePublicKey writes the armored public key of a new OpenPGP entity
+func writePublicKey(t *testing.T, file string) {
+	entity, err := openpgp.NewEntity("ops", "", "ops@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+
+	f, err := os.Create(file)
+	require.NoError(t, err)
+	defer f.Close()
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+}
+
+func TestGetSensitiveFile(t *testing.T) {
+	const src = "/etc/origin/master/htpasswd"
+
+	dir, err := ioutil.TempDir("", "cpma-io")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remote := &fakeRemote{dir: filepath.Join(dir, "remote")}
+	defaultFetch, defaultStat := fetchFile, statFile
+	defer func() { fetchFile, statFile = defaultFetch, defaultStat }()
+	fetchFile, statFile = remote.fetch, remote.stat
+	remote.write(t, src, "user:password", time.Now())
+
+	// Kept in clear, readable by its owner only
+	cacheDir := filepath.Join(dir, "clear", "master-0")
+	content, err := GetSensitiveFile("master-0", src, cacheDir, CacheDefault, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "user:password", string(content))
+	info, err := os.Stat(LocalPath(cacheDir, src))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Kept encrypted only, fetched again on every run
+	writePublicKey(t, filepath.Join(dir, "ops.asc"))
+	keyFiles := []string{filepath.Join(dir, "ops.asc")}
+
+	cacheDir = filepath.Join(dir, "encrypted", "master-0")
+	content, err = GetSensitiveFile("master-0", src, cacheDir, CacheDefault, keyFiles)
+	require.NoError(t, err)
+	assert.Equal(t, "user:password", string(content))
+	_, err = os.Stat(LocalPath(cacheDir, src))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(LocalPath(cacheDir, src) + encrypt.Suffix)
+	require.NoError(t, err)
+
+	_, err = GetSensitiveFile("master-0", src, cacheDir, CacheOffline, keyFiles)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "restore it with cpma decrypt")
+
+	// The plaintext is fetched out of the cache, into files removed even when
+	// the fetch fails halfway
+	fetchFile = func(host, src, target string) error {
+		remote.targets = append(remote.targets, target)
+		ioutil.WriteFile(target, []byte("user:"), 0644)
+		return &sftpclient.FetchError{Kind: sftpclient.NetworkError, Host: host, Path: src}
+	}
+	_, err = GetSensitiveFile("master-0", src, filepath.Join(dir, "failed", "master-0"), CacheDefault, keyFiles)
+	require.Error(t, err)
+	require.Len(t, remote.targets, 3)
+	for _, target := range remote.targets {
+		assert.False(t, strings.HasPrefix(target, dir), target)
+		_, err = os.Stat(target)
+		assert.True(t, os.IsNotExist(err), target)
+	}
+}
@@ -0,0 +1,123 @@
+package io
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest in each host cache directory
+const ManifestFile = "manifest.json"
+
+// FetchedFile records a file fetched from a host
+type FetchedFile struct {
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	ModTime   time.Time `json:"modTime"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// Manifest lists the files fetched from a host, sorted by path
+type Manifest struct {
+	Files []FetchedFile `json:"files"`
+}
+
+// manifestMutex serializes updates of manifest files
+var manifestMutex sync.Mutex
+
+// ReadManifest reads the manifest of cacheDir, empty if there is none yet
+func ReadManifest(cacheDir string) (*Manifest, error) {
+	manifest := &Manifest{}
+
+	content, err := ioutil.ReadFile(filepath.Join(cacheDir, ManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Write stores the manifest in cacheDir
+func (m *Manifest) Write(cacheDir string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(cacheDir, ManifestFile), content, 0644)
+}
+
+// Get returns the record of path
+func (m *Manifest) Get(path string) (FetchedFile, bool) {
+	i := sort.Search(len(m.Files), func(i int) bool { return m.Files[i].Path >= path })
+	if i < len(m.Files) && m.Files[i].Path == path {
+		return m.Files[i], true
+	}
+
+	return FetchedFile{}, false
+}
+
+// Set adds or replaces the record of file.Path
+func (m *Manifest) Set(file FetchedFile) {
+	i := sort.Search(len(m.Files), func(i int) bool { return m.Files[i].Path >= file.Path })
+	if i < len(m.Files) && m.Files[i].Path == file.Path {
+		m.Files[i] = file
+		return
+	}
+
+	m.Files = append(m.Files, FetchedFile{})
+	copy(m.Files[i+1:], m.Files[i:])
+	m.Files[i] = file
+}
+
+// record adds file to the manifest of cacheDir
+func record(cacheDir string, file FetchedFile) error {
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	manifest, err := ReadManifest(cacheDir)
+	if err != nil {
+		return err
+	}
+	manifest.Set(file)
+
+	return manifest.Write(cacheDir)
+}
+
+// lookup returns the record of path in the manifest of cacheDir
+func lookup(cacheDir, path string) (FetchedFile, bool, error) {
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+
+	manifest, err := ReadManifest(cacheDir)
+	if err != nil {
+		return FetchedFile{}, false, err
+	}
+	file, ok := manifest.Get(path)
+
+	return file, ok, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
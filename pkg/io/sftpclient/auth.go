@@ -0,0 +1,305 @@
+package sftpclient
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// PassphraseEnv is the environment variable holding the private key passphrase
+	PassphraseEnv = "CPMA_SSH_PASSPHRASE"
+	// PasswordEnv is the environment variable holding the login password
+	PasswordEnv = "CPMA_SSH_PASSWORD"
+)
+
+// Creds holds SSH authentication settings, read from SSHCreds in the configuration
+type Creds struct {
+	Login      string
+	PrivateKey string
+	Passphrase string
+	Password   string
+	Agent      bool
+	Port       int
+	// ProxyJump lists bastions to go through, in order, as [user@]host[:port]
+	ProxyJump []string
+}
+
+// prompted keeps passphrases entered on the terminal, by private key file, so
+// concurrent connections only prompt once
+var prompted = struct {
+	sync.Mutex
+	passphrases map[string][]byte
+}{passphrases: make(map[string][]byte)}
+
+// readPassphrase prompts for the private key passphrase on the terminal
+var readPassphrase = func(privateKey string) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", privateKey)
+	passphrase, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// LoadCreds reads SSHCreds from the configuration. Passphrase and Password
+// fall back to CPMA_SSH_PASSPHRASE and CPMA_SSH_PASSWORD.
+func LoadCreds() (Creds, error) {
+	sshCreds := env.Config().GetStringMapString("SSHCreds")
+
+	creds := Creds{
+		Login:      sshCreds["login"],
+		PrivateKey: sshCreds["privatekey"],
+		Passphrase: sshCreds["passphrase"],
+		Password:   sshCreds["password"],
+		Agent:      env.Config().GetBool("SSHCreds.Agent"),
+		Port:       22,
+	}
+
+	if creds.Passphrase == "" {
+		creds.Passphrase = os.Getenv(PassphraseEnv)
+	}
+	if creds.Password == "" {
+		creds.Password = os.Getenv(PasswordEnv)
+	}
+
+	if p := sshCreds["port"]; p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return Creds{}, errors.New("Port number " + p + " is wrong.")
+		}
+		creds.Port = port
+	}
+
+	// ProxyJump can be a list or, as with OpenSSH, a comma separated string
+	for _, hops := range env.Config().GetStringSlice("SSHCreds.ProxyJump") {
+		for _, hop := range strings.Split(hops, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				creds.ProxyJump = append(creds.ProxyJump, hop)
+			}
+		}
+	}
+
+	return creds, nil
+}
+
+// authMethods returns the authentication methods to try, in order: ssh-agent and
+// private key, password, then keyboard-interactive answered with the password.
+// The returned function releases the ssh-agent connection.
+func (c Creds) authMethods() ([]ssh.AuthMethod, func(), error) {
+	var (
+		methods []ssh.AuthMethod
+		signers []ssh.Signer
+		release = func() {}
+	)
+
+	if c.Agent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.New("ssh-agent requested but SSH_AUTH_SOCK is not set")
+		}
+
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			logrus.Errorf("Unable to connect to ssh-agent at %s", socket)
+			return nil, nil, err
+		}
+		release = func() { conn.Close() }
+
+		agentSigners, err := agent.NewClient(conn).Signers()
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		signers = append(signers, agentSigners...)
+	}
+
+	if c.PrivateKey != "" {
+		signer, err := c.parsePrivateKey()
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	// Each method is only tried once, so all keys go in a single one
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if c.Password != "" {
+		password := c.Password
+		methods = append(methods,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		)
+	}
+
+	if len(methods) == 0 {
+		release()
+		return nil, nil, errors.New("no SSH authentication configured, set SSHCreds PrivateKey, Agent or Password")
+	}
+
+	return methods, release, nil
+}
+
+// parsePrivateKey reads PrivateKey, decrypting it with Passphrase, or a
+// passphrase prompted for, when it is encrypted.
+// Only PEM encrypted keys are supported, convert others with `ssh-keygen -p -m PEM`.
+func (c Creds) parsePrivateKey() (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(c.PrivateKey)
+	if err != nil {
+		logrus.Errorf("Unable to read private key: %s", c.PrivateKey)
+		return nil, err
+	}
+
+	block, _ := pem.Decode(key)
+	if block == nil || !strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			logrus.Error("Unable to parse private key")
+			return nil, err
+		}
+		return signer, nil
+	}
+
+	passphrase := []byte(c.Passphrase)
+	if len(passphrase) == 0 {
+		prompted.Lock()
+		defer prompted.Unlock()
+
+		passphrase = prompted.passphrases[c.PrivateKey]
+		if passphrase == nil {
+			passphrase, err = readPassphrase(c.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			prompted.passphrases[c.PrivateKey] = passphrase
+		}
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		logrus.Error("Unable to decrypt private key")
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// Dial connects to source, going through the ProxyJump bastions if any.
+// Bastion connections are closed when the returned client is.
+func (c Creds) Dial(source string, hostKeyCallback ssh.HostKeyCallback) (*ssh.Client, error) {
+	methods, release, err := c.authMethods()
+	if err != nil {
+		return nil, &dialError{kind: AuthError, err: err}
+	}
+	// Keys from ssh-agent are only needed during authentication
+	defer release()
+
+	// The handshake error does not tell a rejected host key apart, keep it
+	var hostKeyErr error
+	checkHostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := hostKeyCallback(hostname, remote, key); err != nil {
+			hostKeyErr = err
+			return err
+		}
+		return nil
+	}
+
+	hops := append(append([]string{}, c.ProxyJump...), c.Login+"@"+net.JoinHostPort(source, strconv.Itoa(c.Port)))
+
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for _, hop := range hops {
+		user, addr := c.parseHop(hop)
+		config := &ssh.ClientConfig{
+			User:            user,
+			Auth:            methods,
+			HostKeyCallback: checkHostKey,
+			Timeout:         10 * time.Second,
+		}
+
+		logrus.Debug("Connecting to ", addr)
+		client, err := dialHop(clients, addr, config)
+		if err != nil {
+			logrus.Errorf("Cannot connect to %s", addr)
+			closeAll()
+			if hostKeyErr != nil {
+				return nil, &dialError{kind: HostKeyError, err: hostKeyErr}
+			}
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	target := clients[len(clients)-1]
+	if bastions := clients[:len(clients)-1]; len(bastions) > 0 {
+		go func() {
+			target.Wait()
+			for i := len(bastions) - 1; i >= 0; i-- {
+				bastions[i].Close()
+			}
+		}()
+	}
+
+	return target, nil
+}
+
+// dialHop connects to addr, directly or through the last client of the chain
+func dialHop(chain []*ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(chain) == 0 {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := chain[len(chain)-1].Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// parseHop splits [user@]host[:port], defaulting to Login and port 22
+func (c Creds) parseHop(hop string) (string, string) {
+	user := c.Login
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		user, hop = hop[:i], hop[i+1:]
+	}
+
+	if _, _, err := net.SplitHostPort(hop); err != nil {
+		hop = net.JoinHostPort(hop, "22")
+	}
+
+	return user, hop
+}
@@ -0,0 +1,293 @@
+package sftpclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func serverPort(t *testing.T, server *testServer) int {
+	_, p, err := net.SplitHostPort(server.addr())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(p)
+	require.NoError(t, err)
+	return port
+}
+
+// hostKeys accepts the host keys of the given servers only
+func hostKeys(servers ...*testServer) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, server := range servers {
+			if bytes.Equal(server.hostKey.PublicKey().Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return errors.New("unknown host key")
+	}
+}
+
+// publicKeyServer accepts the "test" user authenticated with key
+func publicKeyServer(t *testing.T, key ssh.PublicKey) *testServer {
+	return newTestServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, offered ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "test" && bytes.Equal(offered.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+			return nil, errTestAuth
+		},
+	})
+}
+
+// writeEncryptedKey writes a PEM encrypted private key, returning its path
+func writeEncryptedKey(t *testing.T, dir string, key *ecdsa.PrivateKey, passphrase string) string {
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte(passphrase), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "id_ecdsa")
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path
+}
+
+func TestDialPassword(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.close()
+
+	testCases := []struct {
+		name        string
+		password    string
+		expectederr bool
+	}{
+		{
+			name:     "authenticate with password",
+			password: "secret",
+		},
+		{
+			name:        "fail with wrong password",
+			password:    "wrong",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds := Creds{Login: "test", Password: tc.password, Port: serverPort(t, server)}
+			client, err := creds.Dial("127.0.0.1", hostKeys(server))
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			client.Close()
+		})
+	}
+}
+
+func TestDialKeyboardInteractive(t *testing.T) {
+	server := newTestServer(t, &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("test", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if conn.User() == "test" && len(answers) == 1 && answers[0] == "secret" {
+				return nil, nil
+			}
+			return nil, errTestAuth
+		},
+	})
+	defer server.close()
+
+	creds := Creds{Login: "test", Password: "secret", Port: serverPort(t, server)}
+	client, err := creds.Dial("127.0.0.1", hostKeys(server))
+	require.NoError(t, err)
+	client.Close()
+}
+
+func TestDialEncryptedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	keyFile := writeEncryptedKey(t, dir, key, "passphrase")
+
+	server := publicKeyServer(t, signer.PublicKey())
+	defer server.close()
+
+	defaultReadPassphrase := readPassphrase
+	defer func() { readPassphrase = defaultReadPassphrase }()
+
+	testCases := []struct {
+		name        string
+		passphrase  string
+		prompted    string
+		expectederr bool
+	}{
+		{
+			name:       "decrypt key with configured passphrase",
+			passphrase: "passphrase",
+		},
+		{
+			name:     "decrypt key with prompted passphrase",
+			prompted: "passphrase",
+		},
+		{
+			name:        "fail with wrong passphrase",
+			passphrase:  "wrong",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			readPassphrase = func(string) ([]byte, error) {
+				if tc.prompted == "" {
+					return nil, errors.New("unexpected prompt")
+				}
+				return []byte(tc.prompted), nil
+			}
+
+			creds := Creds{Login: "test", PrivateKey: keyFile, Passphrase: tc.passphrase, Port: serverPort(t, server)}
+			client, err := creds.Dial("127.0.0.1", hostKeys(server))
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			client.Close()
+		})
+	}
+}
+
+func TestDialAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	defaultSocket, hadSocket := os.LookupEnv("SSH_AUTH_SOCK")
+	defer func() {
+		if hadSocket {
+			os.Setenv("SSH_AUTH_SOCK", defaultSocket)
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		}
+	}()
+	os.Setenv("SSH_AUTH_SOCK", socket)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	server := publicKeyServer(t, signer.PublicKey())
+	defer server.close()
+
+	creds := Creds{Login: "test", Agent: true, Port: serverPort(t, server)}
+	client, err := creds.Dial("127.0.0.1", hostKeys(server))
+	require.NoError(t, err)
+	client.Close()
+}
+
+func TestDialProxyJump(t *testing.T) {
+	bastion := newTestServer(t, nil)
+	defer bastion.close()
+	target := newTestServer(t, nil)
+	defer target.close()
+
+	creds := Creds{
+		Login:     "test",
+		Password:  "secret",
+		Port:      serverPort(t, target),
+		ProxyJump: []string{"test@" + bastion.addr()},
+	}
+
+	pool := NewPool(func(hostname string) (*ssh.Client, error) {
+		return creds.Dial(hostname, hostKeys(bastion, target))
+	})
+	defer pool.Close()
+
+	dir, err := ioutil.TempDir("", "cpma-proxyjump")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "master-config.yaml")
+	require.NoError(t, ioutil.WriteFile(src, []byte("kind: MasterConfig"), 0644))
+
+	require.NoError(t, pool.Fetch("127.0.0.1", src, filepath.Join(dir, "fetched")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bastion.connections))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&target.connections))
+}
+
+func TestLoadCreds(t *testing.T) {
+	defer env.Config().Set("SSHCreds", nil)
+
+	defaultPassphrase, hadPassphrase := os.LookupEnv(PassphraseEnv)
+	defer func() {
+		if hadPassphrase {
+			os.Setenv(PassphraseEnv, defaultPassphrase)
+		} else {
+			os.Unsetenv(PassphraseEnv)
+		}
+	}()
+	os.Setenv(PassphraseEnv, "from-env")
+
+	env.Config().Set("SSHCreds", map[string]interface{}{
+		"Login":      "cloud-user",
+		"PrivateKey": "/home/test/.ssh/id_rsa",
+		"Port":       2222,
+		"Agent":      true,
+		"ProxyJump":  "jump@bastion-1.example.com:2022,bastion-2.example.com",
+	})
+
+	creds, err := LoadCreds()
+	require.NoError(t, err)
+	assert.Equal(t, Creds{
+		Login:      "cloud-user",
+		PrivateKey: "/home/test/.ssh/id_rsa",
+		Passphrase: "from-env",
+		Agent:      true,
+		Port:       2222,
+		ProxyJump:  []string{"jump@bastion-1.example.com:2022", "bastion-2.example.com"},
+	}, creds)
+
+	user, addr := creds.parseHop(creds.ProxyJump[1])
+	assert.Equal(t, "cloud-user", user)
+	assert.Equal(t, "bastion-2.example.com:22", addr)
+}
@@ -0,0 +1,123 @@
+package sftpclient
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// FetchErrorKind tells why a file could not be fetched
+type FetchErrorKind int
+
+const (
+	// OtherError is any failure not classified below
+	OtherError FetchErrorKind = iota
+	// NotFoundError means the file does not exist on the host
+	NotFoundError
+	// PermissionError means the file exists but the login cannot read it
+	PermissionError
+	// AuthError means the host refused the SSH credentials
+	AuthError
+	// NetworkError means the host could not be reached or the connection dropped
+	NetworkError
+	// HostKeyError means the host key was unknown, changed or not pinned
+	HostKeyError
+)
+
+var kindNames = map[FetchErrorKind]string{
+	OtherError:      "error",
+	NotFoundError:   "not found",
+	PermissionError: "permission denied",
+	AuthError:       "authentication failed",
+	NetworkError:    "network error",
+	HostKeyError:    "host key rejected",
+}
+
+func (k FetchErrorKind) String() string {
+	return kindNames[k]
+}
+
+// FetchError is returned when a file could not be fetched from a host
+type FetchError struct {
+	Kind FetchErrorKind
+	Host string
+	Path string
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return e.Host + ":" + e.Path + ": " + e.Kind.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Unreachable tells the host could not be used at all, as opposed to a file
+// missing or unreadable on it
+func (e *FetchError) Unreachable() bool {
+	return e.Kind == AuthError || e.Kind == NetworkError || e.Kind == HostKeyError
+}
+
+// AsFetchError returns the FetchError err is or wraps, if any
+func AsFetchError(err error) (*FetchError, bool) {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr, true
+	}
+
+	return nil, false
+}
+
+// dialError marks errors of connecting to a host with their kind
+type dialError struct {
+	kind FetchErrorKind
+	err  error
+}
+
+func (e *dialError) Error() string {
+	return e.err.Error()
+}
+
+// dialKind classifies errors of connecting to a host, network by default
+func dialKind(err error) FetchErrorKind {
+	if dialErr, ok := err.(*dialError); ok {
+		return dialErr.kind
+	}
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return AuthError
+	}
+
+	return NetworkError
+}
+
+// copyKind classifies errors of reading a file on a connected host
+func copyKind(err error) FetchErrorKind {
+	switch e := err.(type) {
+	case *sftp.StatusError:
+		if e.Code == uint32(sftp.ErrSshFxPermissionDenied) {
+			return PermissionError
+		}
+		if e.Code == uint32(sftp.ErrSshFxNoSuchFile) {
+			return NotFoundError
+		}
+	case *SudoError:
+		switch {
+		case strings.Contains(e.Stderr, "No such file"):
+			return NotFoundError
+		case strings.Contains(e.Stderr, "password is required"),
+			strings.Contains(e.Stderr, "not in the sudoers"),
+			strings.Contains(e.Stderr, "Permission denied"):
+			return PermissionError
+		}
+	}
+
+	if err == os.ErrNotExist {
+		return NotFoundError
+	}
+
+	return OtherError
+}
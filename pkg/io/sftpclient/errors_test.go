@@ -0,0 +1,126 @@
+package sftpclient
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFetchErrorKind(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.close()
+
+	dir, err := ioutil.TempDir("", "cpma-errors")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	denied := filepath.Join(dir, "denied.key")
+	require.NoError(t, ioutil.WriteFile(denied, []byte("root only"), 0600))
+	server.denied = map[string]bool{denied: true}
+
+	// A port nobody listens on any more
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	dialWith := func(addr, password string, hostKey ssh.HostKeyCallback) Dialer {
+		return func(hostname string) (*ssh.Client, error) {
+			_, port, err := net.SplitHostPort(addr)
+			require.NoError(t, err)
+			creds := Creds{Login: "test", Password: password}
+			creds.Port, err = net.LookupPort("tcp", port)
+			require.NoError(t, err)
+			return creds.Dial("127.0.0.1", hostKey)
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		dial         Dialer
+		src          string
+		expectedKind FetchErrorKind
+		unreachable  bool
+	}{
+		{
+			name:         "missing file",
+			dial:         server.dialer(),
+			src:          filepath.Join(dir, "missing"),
+			expectedKind: NotFoundError,
+		},
+		{
+			name:         "unreadable file",
+			dial:         server.dialer(),
+			src:          denied,
+			expectedKind: PermissionError,
+		},
+		{
+			name:         "wrong password",
+			dial:         dialWith(server.addr(), "wrong", hostKeys(server)),
+			src:          denied,
+			expectedKind: AuthError,
+			unreachable:  true,
+		},
+		{
+			name:         "unknown host key",
+			dial:         dialWith(server.addr(), "secret", hostKeys()),
+			src:          denied,
+			expectedKind: HostKeyError,
+			unreachable:  true,
+		},
+		{
+			name:         "host down",
+			dial:         dialWith(closedAddr, "secret", hostKeys(server)),
+			src:          denied,
+			expectedKind: NetworkError,
+			unreachable:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pool := NewPool(tc.dial)
+			defer pool.Close()
+
+			err := pool.Fetch("master-0", tc.src, filepath.Join(dir, "fetched", tc.name))
+			require.Error(t, err)
+
+			fetchErr, ok := AsFetchError(err)
+			require.True(t, ok)
+			assert.Equal(t, tc.expectedKind, fetchErr.Kind)
+			assert.Equal(t, tc.unreachable, fetchErr.Unreachable())
+			assert.Equal(t, "master-0", fetchErr.Host)
+			assert.Equal(t, tc.src, fetchErr.Path)
+		})
+	}
+}
+
+func TestAsFetchError(t *testing.T) {
+	fetchErr := &FetchError{Kind: NotFoundError, Host: "master-0", Path: "/etc/origin/master/htpasswd", Err: os.ErrNotExist}
+
+	found, ok := AsFetchError(wrapped{fetchErr})
+	require.True(t, ok)
+	assert.Equal(t, fetchErr, found)
+
+	_, ok = AsFetchError(errors.New("decode error"))
+	assert.False(t, ok)
+}
+
+type wrapped struct {
+	err error
+}
+
+func (w wrapped) Error() string {
+	return "transform: " + w.err.Error()
+}
+
+func (w wrapped) Unwrap() error {
+	return w.err
+}
@@ -0,0 +1,158 @@
+package sftpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	kh "golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy tells what to do with host keys found in no known_hosts file
+type HostKeyPolicy string
+
+const (
+	// StrictPolicy rejects unknown host keys
+	StrictPolicy HostKeyPolicy = "strict"
+	// AcceptNewPolicy trusts unknown host keys on first use, recording them in
+	// the cpma known_hosts. Changed keys are still rejected.
+	AcceptNewPolicy HostKeyPolicy = "accept-new"
+	// InsecurePolicy accepts any host key, without verification
+	InsecurePolicy HostKeyPolicy = "insecure"
+)
+
+// HostKeys verifies SSH host keys against known_hosts files and pinned fingerprints
+type HostKeys struct {
+	Policy HostKeyPolicy
+	// KnownHostsFile is the user known_hosts, ~/.ssh/known_hosts by default
+	KnownHostsFile string
+	// TrustedFile is the cpma known_hosts, where keys trusted on first use go
+	TrustedFile string
+	// Fingerprints pins host keys by host, as SHA256:... or MD5 hex fingerprints
+	Fingerprints map[string][]string
+}
+
+// trustedMutex serializes writes to cpma known_hosts files
+var trustedMutex sync.Mutex
+
+// LoadHostKeys reads KnownHostsFile, HostKeyPolicy and HostKeyFingerprints
+// from the configuration
+func LoadHostKeys() (*HostKeys, error) {
+	home := env.Config().GetString("home")
+
+	h := &HostKeys{
+		Policy:         HostKeyPolicy(env.Config().GetString("HostKeyPolicy")),
+		KnownHostsFile: env.Config().GetString("KnownHostsFile"),
+		TrustedFile:    filepath.Join(home, ".cpma", "known_hosts"),
+		Fingerprints:   env.Config().GetStringMapStringSlice("HostKeyFingerprints"),
+	}
+
+	if h.KnownHostsFile == "" {
+		h.KnownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	switch h.Policy {
+	case "":
+		h.Policy = StrictPolicy
+	case StrictPolicy, AcceptNewPolicy:
+	case InsecurePolicy:
+		logrus.Warn("HostKeyPolicy is insecure: SSH host keys are NOT verified, connections can be intercepted")
+	default:
+		return nil, errors.New("Host key policy " + string(h.Policy) + " is wrong, use strict, accept-new or insecure")
+	}
+
+	return h, nil
+}
+
+// Callback checks the key of hostname, the host:port dialed
+func (h *HostKeys) Callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if h.Policy == InsecurePolicy {
+		logrus.Warnf("Host key of %s NOT verified (%s %s), HostKeyPolicy is insecure",
+			hostname, key.Type(), ssh.FingerprintSHA256(key))
+		return nil
+	}
+
+	host := hostname
+	if name, _, err := net.SplitHostPort(hostname); err == nil {
+		host = name
+	}
+
+	if pinned, ok := h.Fingerprints[strings.ToLower(host)]; ok {
+		for _, fingerprint := range pinned {
+			if fingerprint == ssh.FingerprintSHA256(key) || fingerprint == ssh.FingerprintLegacyMD5(key) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key %s of %s does not match the fingerprints pinned in HostKeyFingerprints",
+			ssh.FingerprintSHA256(key), hostname)
+	}
+
+	// Checking under the lock sees keys just trusted by concurrent connections
+	trustedMutex.Lock()
+	defer trustedMutex.Unlock()
+
+	err := h.checkKnownHosts(hostname, remote, key)
+	keyErr, ok := err.(*kh.KeyError)
+	if !ok || len(keyErr.Want) > 0 {
+		// Known host, or a changed key, which is never trusted
+		return err
+	}
+
+	if h.Policy != AcceptNewPolicy {
+		return fmt.Errorf("host key %s %s of %s is unknown: add it to %s, pin it in HostKeyFingerprints "+
+			"or set HostKeyPolicy to accept-new", key.Type(), ssh.FingerprintSHA256(key), hostname, h.KnownHostsFile)
+	}
+
+	if err := h.trust(hostname, key); err != nil {
+		return err
+	}
+	logrus.Warnf("Trusting host key %s %s of %s on first use, recorded in %s",
+		key.Type(), ssh.FingerprintSHA256(key), hostname, h.TrustedFile)
+
+	return nil
+}
+
+// checkKnownHosts looks the key up in the known_hosts files which exist
+func (h *HostKeys) checkKnownHosts(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var files []string
+	for _, file := range []string{h.KnownHostsFile, h.TrustedFile} {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) == 0 {
+		return &kh.KeyError{}
+	}
+
+	callback, err := kh.New(files...)
+	if err != nil {
+		logrus.Errorf("Unable to read known hosts from %s", strings.Join(files, ", "))
+		return err
+	}
+
+	return callback(hostname, remote, key)
+}
+
+// trust appends the key to the cpma known_hosts
+func (h *HostKeys) trust(hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(h.TrustedFile), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.TrustedFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(kh.Line([]string{kh.Normalize(hostname)}, key) + "\n")
+	return err
+}
@@ -0,0 +1,163 @@
+package sftpclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	kh "golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestHostKeysCallback(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.close()
+	key := server.hostKey.PublicKey()
+	otherKey := newTestSigner(t).PublicKey()
+
+	testCases := []struct {
+		name         string
+		policy       HostKeyPolicy
+		knownHosts   ssh.PublicKey
+		fingerprints []string
+		expectederr  bool
+		trusted      bool
+	}{
+		{
+			name:       "accept key in known_hosts",
+			policy:     StrictPolicy,
+			knownHosts: key,
+		},
+		{
+			name:        "reject unknown key",
+			policy:      StrictPolicy,
+			expectederr: true,
+		},
+		{
+			name:        "reject changed key",
+			policy:      AcceptNewPolicy,
+			knownHosts:  otherKey,
+			expectederr: true,
+		},
+		{
+			name:    "trust unknown key on first use",
+			policy:  AcceptNewPolicy,
+			trusted: true,
+		},
+		{
+			name:         "accept pinned fingerprint",
+			policy:       StrictPolicy,
+			fingerprints: []string{ssh.FingerprintSHA256(key)},
+		},
+		{
+			name:         "accept pinned MD5 fingerprint",
+			policy:       StrictPolicy,
+			fingerprints: []string{ssh.FingerprintLegacyMD5(key)},
+		},
+		{
+			name:         "reject key not pinned, even if known",
+			policy:       StrictPolicy,
+			knownHosts:   key,
+			fingerprints: []string{ssh.FingerprintSHA256(otherKey)},
+			expectederr:  true,
+		},
+		{
+			name:   "accept any key when insecure",
+			policy: InsecurePolicy,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cpma-hostkeys")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			hostKeys := &HostKeys{
+				Policy:         tc.policy,
+				KnownHostsFile: filepath.Join(dir, "known_hosts"),
+				TrustedFile:    filepath.Join(dir, ".cpma", "known_hosts"),
+			}
+			if tc.knownHosts != nil {
+				line := kh.Line([]string{kh.Normalize(server.addr())}, tc.knownHosts) + "\n"
+				require.NoError(t, ioutil.WriteFile(hostKeys.KnownHostsFile, []byte(line), 0600))
+			}
+			if tc.fingerprints != nil {
+				hostKeys.Fingerprints = map[string][]string{"127.0.0.1": tc.fingerprints}
+			}
+
+			creds := Creds{Login: "test", Password: "secret", Port: serverPort(t, server)}
+			client, err := creds.Dial("127.0.0.1", hostKeys.Callback)
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			client.Close()
+
+			_, err = os.Stat(hostKeys.TrustedFile)
+			assert.Equal(t, tc.trusted, err == nil)
+			if tc.trusted {
+				// Trusted keys are then verified as known
+				hostKeys.Policy = StrictPolicy
+				client, err := creds.Dial("127.0.0.1", hostKeys.Callback)
+				require.NoError(t, err)
+				client.Close()
+			}
+		})
+	}
+}
+
+func TestLoadHostKeys(t *testing.T) {
+	defer env.Config().Set("HostKeyPolicy", nil)
+	defer env.Config().Set("HostKeyFingerprints", nil)
+
+	env.Config().Set("HostKeyFingerprints", map[string]interface{}{
+		"master-0.example.com": "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU",
+		"master-1.example.com": []interface{}{"SHA256:a", "SHA256:b"},
+	})
+
+	testCases := []struct {
+		name           string
+		policy         string
+		expectedPolicy HostKeyPolicy
+		expectederr    bool
+	}{
+		{
+			name:           "default to strict",
+			expectedPolicy: StrictPolicy,
+		},
+		{
+			name:           "load accept-new",
+			policy:         "accept-new",
+			expectedPolicy: AcceptNewPolicy,
+		},
+		{
+			name:        "fail on unknown policy",
+			policy:      "yes",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env.Config().Set("HostKeyPolicy", tc.policy)
+
+			hostKeys, err := LoadHostKeys()
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPolicy, hostKeys.Policy)
+			assert.Equal(t, map[string][]string{
+				"master-0.example.com": {"SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"},
+				"master-1.example.com": {"SHA256:a", "SHA256:b"},
+			}, hostKeys.Fingerprints)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package sftpclient
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Pool keeps one SSH connection and SFTP session open per host, so every file
+// fetched from a host during a run shares a single handshake.
+// It is safe for concurrent use.
+type Pool struct {
+	// Mode returns how files are read on a host, SFTP if nil
+	Mode func(hostname string) (FetchMode, error)
+
+	dial  Dialer
+	mutex sync.Mutex
+	hosts map[string]*poolEntry
+}
+
+type poolEntry struct {
+	mutex  sync.Mutex
+	client *Client
+}
+
+// NewPool creates a pool opening connections with dial
+func NewPool(dial Dialer) *Pool {
+	return &Pool{
+		dial:  dial,
+		hosts: make(map[string]*poolEntry),
+	}
+}
+
+// Client returns the open client for hostname, connecting first if needed
+func (p *Pool) Client(hostname string) (*Client, error) {
+	mode, err := p.mode(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.client(hostname, mode, nil)
+}
+
+func (p *Pool) mode(hostname string) (FetchMode, error) {
+	if p.Mode == nil {
+		return SFTPMode, nil
+	}
+
+	return p.Mode(hostname)
+}
+
+// client returns the open client for hostname. A client equal to stale is
+// closed and replaced by a new connection.
+func (p *Pool) client(hostname string, mode FetchMode, stale *Client) (*Client, error) {
+	p.mutex.Lock()
+	entry, ok := p.hosts[hostname]
+	if !ok {
+		entry = &poolEntry{}
+		p.hosts[hostname] = entry
+	}
+	p.mutex.Unlock()
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.client != nil {
+		if entry.client != stale {
+			return entry.client, nil
+		}
+
+		logrus.Debugf("SFTP: reconnecting to %s", hostname)
+		entry.client.Close()
+		entry.client = nil
+	}
+
+	client, err := newClient(p.dial, hostname, mode)
+	if err != nil {
+		return nil, err
+	}
+	entry.client = &client
+
+	return entry.client, nil
+}
+
+// Fetch copies src from hostname to dst, over SFTP or with sudo depending on
+// the host's fetch mode. Failures are returned as *FetchError.
+func (p *Pool) Fetch(hostname, src, dst string) error {
+	var bytes int64
+	err := p.run(hostname, src, func(client *Client, mode FetchMode) (err error) {
+		bytes, err = client.copy(mode, src, dst)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.Printf("SFTP: %s:%s: %d bytes copied", hostname, src, bytes)
+	return nil
+}
+
+// Stat returns the size and modification time of src on hostname.
+// Failures are returned as *FetchError.
+func (p *Pool) Stat(hostname, src string) (FileInfo, error) {
+	var info FileInfo
+	err := p.run(hostname, src, func(client *Client, mode FetchMode) (err error) {
+		info, err = client.stat(mode, src)
+		return err
+	})
+
+	return info, err
+}
+
+// Output runs command on hostname and returns its standard output.
+// Failures are returned as *FetchError, with the command as Path.
+func (p *Pool) Output(hostname, command string) ([]byte, error) {
+	var output []byte
+	err := p.run(hostname, command, func(client *Client, mode FetchMode) (err error) {
+		output, err = client.output(command)
+		return err
+	})
+
+	return output, err
+}
+
+// run calls f with the client of hostname. If the connection dropped since it
+// was opened, it reconnects once and calls f again.
+func (p *Pool) run(hostname, src string, f func(*Client, FetchMode) error) error {
+	mode, err := p.mode(hostname)
+	if err != nil {
+		return &FetchError{Kind: OtherError, Host: hostname, Path: src, Err: err}
+	}
+
+	client, err := p.client(hostname, mode, nil)
+	if err != nil {
+		return &FetchError{Kind: dialKind(err), Host: hostname, Path: src, Err: err}
+	}
+
+	err = f(client, mode)
+	if err != nil && !client.alive() {
+		client, err = p.client(hostname, mode, client)
+		if err != nil {
+			return &FetchError{Kind: dialKind(err), Host: hostname, Path: src, Err: err}
+		}
+		err = f(client, mode)
+		if err != nil && !client.alive() {
+			return &FetchError{Kind: NetworkError, Host: hostname, Path: src, Err: err}
+		}
+	}
+	if err != nil {
+		return &FetchError{Kind: copyKind(err), Host: hostname, Path: src, Err: explain(err, hostname, mode)}
+	}
+
+	return nil
+}
+
+func (c *Client) copy(mode FetchMode, src, dst string) (int64, error) {
+	if mode == SudoMode {
+		return c.SudoGetFile(src, dst)
+	}
+
+	return c.GetFile(src, dst)
+}
+
+func (c *Client) stat(mode FetchMode, src string) (FileInfo, error) {
+	if mode == SudoMode {
+		return c.SudoStat(src)
+	}
+
+	if c.Client == nil {
+		return FileInfo{}, errors.New("no SFTP session, files are read with sudo")
+	}
+	info, err := c.Client.Stat(src)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// output runs command in an SSH session
+func (c *Client) output(command string) ([]byte, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(command); err != nil {
+		return nil, &CommandError{Command: command, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// CommandError is returned when a remote command fails
+type CommandError struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr != "" {
+		return e.Command + ": " + e.Stderr
+	}
+	return e.Command + ": " + e.Err.Error()
+}
+
+// Close closes every open connection. The pool can still be used afterwards,
+// connecting again as needed.
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for hostname, entry := range p.hosts {
+		entry.mutex.Lock()
+		if entry.client != nil {
+			entry.client.Close()
+			entry.client = nil
+		}
+		entry.mutex.Unlock()
+		delete(p.hosts, hostname)
+	}
+}
@@ -0,0 +1,99 @@
+package sftpclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolFetch(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.close()
+
+	srcDir, err := ioutil.TempDir("", "cpma-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "cpma-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+
+	files := []string{"master-config.yaml", "htpasswd", "ca.crt", "client.crt", "client.key"}
+	for _, file := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, file), []byte(file), 0644))
+	}
+
+	pool := NewPool(server.dialer())
+	defer pool.Close()
+
+	t.Run("reuse one connection per host", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for _, file := range files {
+			wg.Add(1)
+			go func(file string) {
+				defer wg.Done()
+				dst := filepath.Join(dstDir, "master-0", file)
+				assert.NoError(t, pool.Fetch("master-0", filepath.Join(srcDir, file), dst))
+
+				content, err := ioutil.ReadFile(dst)
+				assert.NoError(t, err)
+				assert.Equal(t, file, string(content))
+			}(file)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+	})
+
+	t.Run("reconnect after the connection dropped", func(t *testing.T) {
+		server.dropConnections()
+
+		dst := filepath.Join(dstDir, "master-0", "reconnect")
+		require.NoError(t, pool.Fetch("master-0", filepath.Join(srcDir, "htpasswd"), dst))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&server.connections))
+	})
+
+	t.Run("return errors on a live connection", func(t *testing.T) {
+		dst := filepath.Join(dstDir, "master-0", "missing")
+		require.Error(t, pool.Fetch("master-0", filepath.Join(srcDir, "missing"), dst))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&server.connections))
+	})
+
+	t.Run("close connections", func(t *testing.T) {
+		client, err := pool.Client("master-0")
+		require.NoError(t, err)
+
+		pool.Close()
+		assert.False(t, client.alive())
+
+		dst := filepath.Join(dstDir, "master-0", "after-close")
+		require.NoError(t, pool.Fetch("master-0", filepath.Join(srcDir, "ca.crt"), dst))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&server.connections))
+	})
+}
+
+func TestPoolOutput(t *testing.T) {
+	server := newTestServer(t, nil)
+	defer server.close()
+	server.outputs = map[string]string{"openshift version": "openshift v3.7.72\nkubernetes v1.7.6+a08f5eeb62\n"}
+
+	pool := NewPool(server.dialer())
+	defer pool.Close()
+
+	output, err := pool.Output("master-0", "openshift version")
+	require.NoError(t, err)
+	assert.Equal(t, "openshift v3.7.72\nkubernetes v1.7.6+a08f5eeb62\n", string(output))
+
+	_, err = pool.Output("master-0", "oc version")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oc version: command not found")
+	fetchErr, ok := AsFetchError(err)
+	require.True(t, ok)
+	assert.Equal(t, OtherError, fetchErr.Kind)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+}
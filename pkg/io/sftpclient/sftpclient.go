@@ -2,91 +2,111 @@ package sftpclient
 
 import (
 	"errors"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
-	"strconv"
 	"time"
 
-	"github.com/fusor/cpma/pkg/env"
 	"github.com/pkg/sftp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
-	kh "golang.org/x/crypto/ssh/knownhosts"
 )
 
 // Client Wrapper around sftp.Client
 type Client struct {
 	*sftp.Client
+	conn *ssh.Client
+}
+
+// FileInfo describes a remote file
+type FileInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Dialer opens an SSH connection to a host
+type Dialer func(hostname string) (*ssh.Client, error)
+
+// defaultPool holds the connections used by Fetch for the whole run
+var defaultPool = newDefaultPool()
+
+func newDefaultPool() *Pool {
+	pool := NewPool(Dial)
+	pool.Mode = ConfiguredFetchMode
+	return pool
 }
 
 // NewClient creates a new SFTP client
 func NewClient(source string) (Client, error) {
-	sshCreds := env.Config().GetStringMapString("SSHCreds")
+	return newClient(Dial, source, SFTPMode)
+}
 
-	key, err := ioutil.ReadFile(sshCreds["privatekey"])
+// newClient connects to source, opening an SFTP session unless files are read
+// with sudo
+func newClient(dial Dialer, source string, mode FetchMode) (Client, error) {
+	connection, err := dial(source)
 	if err != nil {
-		logrus.Errorf("Unable to read private key: %s", sshCreds["privatekey"])
 		return Client{}, err
 	}
 
-	// Create the Signer for this private key.
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		logrus.Error("Unable to parse private key")
-		return Client{}, err
+	if mode == SudoMode {
+		return Client{conn: connection}, nil
 	}
 
-	knownHostsFile := filepath.Join(env.Config().GetString("home"), ".ssh", "known_hosts")
-
-	hostKeyCallback, err := kh.New(knownHostsFile)
+	// create new SFTP client
+	client, err := sftp.NewClient(connection)
 	if err != nil {
-		logrus.Errorf("Unable to get hostkey in %s", knownHostsFile)
+		logrus.Error("Unable to create new SFTP client")
+		connection.Close()
 		return Client{}, err
 	}
 
-	sshConfig := &ssh.ClientConfig{
-		User: sshCreds["login"],
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: hostKeyCallback,
+	return Client{Client: client, conn: connection}, nil
+}
 
-		Timeout: 10 * time.Second,
+// Dial opens an SSH connection to source using SSHCreds from the configuration
+func Dial(source string) (*ssh.Client, error) {
+	creds, err := LoadCreds()
+	if err != nil {
+		return nil, err
 	}
 
-	port := 22
-	if p := sshCreds["port"]; p != "" {
-		port, err = strconv.Atoi(p)
-		if err != nil || port < 1 || port > 65535 {
-			return Client{}, errors.New("Port number " + p + " is wrong.")
-		}
+	hostKeys, err := LoadHostKeys()
+	if err != nil {
+		return nil, err
 	}
 
-	addr := fmt.Sprintf("%s:%d", source, port)
-	logrus.Debug("Connecting to", addr)
+	return creds.Dial(source, hostKeys.Callback)
+}
 
-	connection, err := ssh.Dial("tcp", addr, sshConfig)
-	if err != nil {
-		logrus.Errorf("Cannot connect to %s", addr)
-		return Client{}, err
+// Close closes the SFTP session and the SSH connection under it
+func (c *Client) Close() error {
+	var err error
+	if c.Client != nil {
+		err = c.Client.Close()
+	}
+	if c.conn != nil {
+		c.conn.Close()
 	}
+	return err
+}
 
-	// create new SFTP client
-	client, err := sftp.NewClient(connection)
-	if err != nil {
-		logrus.Error("Unable to create new SFTP client")
-		return Client{}, err
+// alive checks the SSH connection still answers
+func (c *Client) alive() bool {
+	if c.conn == nil {
+		return false
 	}
 
-	return Client{client}, nil
+	_, _, err := c.conn.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
 }
 
 // GetFile copies source file to destination file
 func (c *Client) GetFile(srcFilePath string, dstFilePath string) (int64, error) {
+	if c.Client == nil {
+		return int64(0), errors.New("no SFTP session, files are read with sudo")
+	}
+
 	srcFile, err := c.Open(srcFilePath)
 	if err != nil {
 		// int64(0) empty value to return in case of error
@@ -111,20 +131,23 @@ func (c *Client) GetFile(srcFilePath string, dstFilePath string) (int64, error)
 	return bytes, err
 }
 
-// Fetch retrieves a file
+// Fetch retrieves a file, reusing the connection to hostname
 func Fetch(hostname, src, dst string) error {
-	client, err := NewClient(hostname)
-	if err != nil {
-		return err
-	}
+	return defaultPool.Fetch(hostname, src, dst)
+}
 
-	defer client.Close()
+// Stat returns the size and modification time of a remote file, reusing the
+// connection to hostname
+func Stat(hostname, src string) (FileInfo, error) {
+	return defaultPool.Stat(hostname, src)
+}
 
-	bytes, err := client.GetFile(src, dst)
-	if err != nil {
-		return err
-	}
+// Output runs a command on hostname, reusing the connection to hostname
+func Output(hostname, command string) ([]byte, error) {
+	return defaultPool.Output(hostname, command)
+}
 
-	logrus.Printf("SFTP: %s:%s: %d bytes copied", hostname, src, bytes)
-	return nil
+// Close closes every connection opened by Fetch
+func Close() {
+	defaultPool.Close()
 }
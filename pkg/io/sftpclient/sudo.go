@@ -0,0 +1,156 @@
+package sftpclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/pkg/sftp"
+)
+
+// FetchMode selects how files are read on a host
+type FetchMode string
+
+const (
+	// SFTPMode reads files over SFTP with the permissions of the SSH login
+	SFTPMode FetchMode = "sftp"
+	// SudoMode reads files with `sudo -n cat`, and `sudo -n stat`, in an SSH
+	// session, for files only root can read. The SSH login needs passwordless sudo.
+	SudoMode FetchMode = "sudo"
+)
+
+// ConfiguredFetchMode returns the fetch mode of hostname, set in FetchModes,
+// else in FetchMode, SFTP by default
+func ConfiguredFetchMode(hostname string) (FetchMode, error) {
+	mode := env.Config().GetStringMapString("FetchModes")[strings.ToLower(hostname)]
+	if mode == "" {
+		mode = env.Config().GetString("FetchMode")
+	}
+
+	switch FetchMode(mode) {
+	case "", SFTPMode:
+		return SFTPMode, nil
+	case SudoMode:
+		return SudoMode, nil
+	default:
+		return "", errors.New("Fetch mode " + mode + " for " + hostname + " is wrong, use sftp or sudo")
+	}
+}
+
+// SudoGetFile copies source file to destination file using `sudo -n cat`
+func (c *Client) SudoGetFile(srcFilePath string, dstFilePath string) (int64, error) {
+	os.MkdirAll(path.Dir(dstFilePath), 0755)
+	dstFile, err := os.Create(dstFilePath)
+	if err != nil {
+		return int64(0), err
+	}
+	defer dstFile.Close()
+
+	counter := &countingWriter{w: dstFile}
+	if err := c.sudo(srcFilePath, "cat -- "+ShellQuote(srcFilePath), counter); err != nil {
+		// Never leave a partial copy, it would be read as the file later on
+		dstFile.Close()
+		os.Remove(dstFilePath)
+		return int64(0), err
+	}
+
+	return counter.n, nil
+}
+
+// SudoStat returns the size and modification time of a file using `sudo -n stat`
+func (c *Client) SudoStat(srcFilePath string) (FileInfo, error) {
+	var out bytes.Buffer
+	if err := c.sudo(srcFilePath, "stat -c '%s %Y' -- "+ShellQuote(srcFilePath), &out); err != nil {
+		return FileInfo{}, err
+	}
+
+	fields := strings.Fields(out.String())
+	if len(fields) != 2 {
+		return FileInfo{}, errors.New("unexpected stat output for " + srcFilePath + ": " + out.String())
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	mtime, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{Size: size, ModTime: time.Unix(mtime, 0)}, nil
+}
+
+// sudo runs `sudo -n <command>` about srcFilePath in an SSH session
+func (c *Client) sudo(srcFilePath, command string, stdout io.Writer) error {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdout = stdout
+	session.Stderr = &stderr
+
+	if err := session.Run("sudo -n " + command); err != nil {
+		return &SudoError{Path: srcFilePath, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+
+	return nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SudoError is returned when a command run with sudo fails
+type SudoError struct {
+	Path   string
+	Stderr string
+	Err    error
+}
+
+func (e *SudoError) Error() string {
+	if e.Stderr != "" {
+		return "sudo " + e.Path + ": " + e.Stderr
+	}
+	return "sudo " + e.Path + ": " + e.Err.Error()
+}
+
+// explain tells which fetch mode to use when a file could not be read
+func explain(err error, hostname string, mode FetchMode) error {
+	switch e := err.(type) {
+	case *sftp.StatusError:
+		if mode == SFTPMode && e.Code == uint32(sftp.ErrSshFxPermissionDenied) {
+			return fmt.Errorf("not readable by the SSH login over SFTP, "+
+				"set FetchModes for %s to sudo to read it with sudo: %v", hostname, err)
+		}
+	case *SudoError:
+		if strings.Contains(e.Stderr, "password is required") {
+			return fmt.Errorf("sudo requires a password, "+
+				"sudo fetch mode needs passwordless sudo (NOPASSWD) for the SSH login: %v", err)
+		}
+	}
+
+	return err
+}
+
+// ShellQuote quotes s for a POSIX shell
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,121 @@
+package sftpclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolFetchMode(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "cpma-src")
+	require.NoError(t, err)
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "cpma-dst")
+	require.NoError(t, err)
+	defer os.RemoveAll(dstDir)
+
+	src := filepath.Join(srcDir, "it's-root-only.key")
+	require.NoError(t, ioutil.WriteFile(src, []byte("root only"), 0600))
+
+	testCases := []struct {
+		name         string
+		mode         FetchMode
+		sudoPassword bool
+		expectederr  string
+	}{
+		{
+			name: "read root only file with sudo",
+			mode: SudoMode,
+		},
+		{
+			name:        "explain permission denied over SFTP",
+			mode:        SFTPMode,
+			expectederr: "set FetchModes for master-0 to sudo",
+		},
+		{
+			name:         "explain sudo requiring a password",
+			mode:         SudoMode,
+			sudoPassword: true,
+			expectederr:  "needs passwordless sudo (NOPASSWD)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+			defer server.close()
+			server.denied = map[string]bool{src: true}
+			server.sudoPassword = tc.sudoPassword
+
+			pool := NewPool(server.dialer())
+			pool.Mode = func(string) (FetchMode, error) { return tc.mode, nil }
+			defer pool.Close()
+
+			dst := filepath.Join(dstDir, "master-0", tc.name)
+			err := pool.Fetch("master-0", src, dst)
+			if tc.expectederr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectederr)
+				_, err := os.Stat(dst)
+				assert.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+
+			content, err := ioutil.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, "root only", string(content))
+		})
+	}
+}
+
+func TestConfiguredFetchMode(t *testing.T) {
+	defer env.Config().Set("FetchMode", nil)
+	defer env.Config().Set("FetchModes", nil)
+
+	env.Config().Set("FetchMode", "sftp")
+	env.Config().Set("FetchModes", map[string]interface{}{
+		"master-0.example.com": "sudo",
+		"master-1.example.com": "scp",
+	})
+
+	testCases := []struct {
+		name         string
+		hostname     string
+		expectedMode FetchMode
+		expectederr  bool
+	}{
+		{
+			name:         "use host fetch mode",
+			hostname:     "Master-0.example.com",
+			expectedMode: SudoMode,
+		},
+		{
+			name:         "default to FetchMode",
+			hostname:     "node-0.example.com",
+			expectedMode: SFTPMode,
+		},
+		{
+			name:        "fail on unknown fetch mode",
+			hostname:    "master-1.example.com",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mode, err := ConfiguredFetchMode(tc.hostname)
+			if tc.expectederr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedMode, mode)
+		})
+	}
+}
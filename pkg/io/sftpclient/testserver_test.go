@@ -0,0 +1,318 @@
+package sftpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server offering the sftp subsystem over the
+// local filesystem, and running `sudo -n cat` as a remote command
+type testServer struct {
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	hostKey     ssh.Signer
+	connections int32
+
+	// denied lists files the login cannot read over SFTP
+	denied map[string]bool
+	// sudoPassword makes sudo require a password, as without NOPASSWD
+	sudoPassword bool
+	// outputs are the outputs of other commands the server knows
+	outputs map[string]string
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+// newTestServer starts a server accepting the "test" user with password "secret",
+// unless config is given
+func newTestServer(t *testing.T, config *ssh.ServerConfig) *testServer {
+	if config == nil {
+		config = &ssh.ServerConfig{
+			PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				if conn.User() == "test" && string(password) == "secret" {
+					return nil, nil
+				}
+				return nil, errTestAuth
+			},
+		}
+	}
+
+	hostKey := newTestSigner(t)
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testServer{listener: listener, config: config, hostKey: hostKey}
+	go s.serve()
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.connections, 1)
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go forward(newChannel)
+			continue
+		}
+
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				switch {
+				case req.Type == "exec":
+					req.Reply(true, nil)
+					s.exec(channel, string(req.Payload[4:]))
+					return
+				case req.Type == "subsystem" && string(req.Payload[4:]) == "sftp":
+					req.Reply(true, nil)
+					s.sftp(channel)
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+func (s *testServer) sftp(channel ssh.Channel) {
+	defer channel.Close()
+
+	if s.denied != nil {
+		handler := testHandler{s}
+		sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  handler,
+			FilePut:  handler,
+			FileCmd:  handler,
+			FileList: handler,
+		}).Serve()
+		return
+	}
+
+	server, err := sftp.NewServer(channel)
+	if err != nil {
+		return
+	}
+	server.Serve()
+}
+
+// exec runs `sudo -n cat -- 'path'` and `sudo -n stat -c '%s %Y' -- 'path'`,
+// and answers the commands listed in outputs
+func (s *testServer) exec(channel ssh.Channel, command string) {
+	defer channel.Close()
+
+	status := uint32(0)
+	defer func() {
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	}()
+
+	var stat bool
+	var quoted string
+	switch {
+	case strings.HasPrefix(command, "sudo -n cat -- "):
+		quoted = strings.TrimPrefix(command, "sudo -n cat -- ")
+	case strings.HasPrefix(command, "sudo -n stat -c '%s %Y' -- "):
+		quoted = strings.TrimPrefix(command, "sudo -n stat -c '%s %Y' -- ")
+		stat = true
+	case s.outputs[command] != "":
+		fmt.Fprint(channel, s.outputs[command])
+		return
+	default:
+		fmt.Fprintf(channel.Stderr(), "%s: command not found\n", command)
+		status = 127
+		return
+	}
+	if s.sudoPassword {
+		fmt.Fprintln(channel.Stderr(), "sudo: a password is required")
+		status = 1
+		return
+	}
+
+	path := strings.Replace(strings.Trim(quoted, "'"), `'\''`, "'", -1)
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(channel.Stderr(), "%s: No such file or directory\n", path)
+		status = 1
+		return
+	}
+	defer file.Close()
+
+	if stat {
+		info, err := file.Stat()
+		if err != nil {
+			status = 1
+			return
+		}
+		fmt.Fprintf(channel, "%d %d\n", info.Size(), info.ModTime().Unix())
+		return
+	}
+	io.Copy(channel, file)
+}
+
+// testHandler serves SFTP reads, refusing the server's denied files
+type testHandler struct {
+	s *testServer
+}
+
+func (h testHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if h.s.denied[r.Filepath] {
+		return nil, sftp.ErrSshFxPermissionDenied
+	}
+	return os.Open(r.Filepath)
+}
+
+func (h testHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return nil, sftp.ErrSshFxOpUnsupported
+}
+
+func (h testHandler) Filecmd(r *sftp.Request) error {
+	return sftp.ErrSshFxOpUnsupported
+}
+
+// Filelist only answers stat, allowed on denied files as with real permissions
+func (h testHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if r.Method != "Stat" && r.Method != "Lstat" {
+		return nil, sftp.ErrSshFxOpUnsupported
+	}
+
+	info, err := os.Stat(r.Filepath)
+	if err != nil {
+		return nil, sftp.ErrSshFxNoSuchFile
+	}
+	return listerAt{info}, nil
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// forward serves a direct-tcpip channel, as a bastion does for ProxyJump
+func forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+// addr returns the host:port the server listens on
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// dropConnections closes every client connection, as a restarted sshd would
+func (s *testServer) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+// dialer connects to the server whatever the hostname, with the test credentials
+func (s *testServer) dialer() Dialer {
+	return func(hostname string) (*ssh.Client, error) {
+		return ssh.Dial("tcp", s.addr(), &ssh.ClientConfig{
+			User:            "test",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: ssh.FixedHostKey(s.hostKey.PublicKey()),
+		})
+	}
+}
+
+var errTestAuth = errors.New("access denied")
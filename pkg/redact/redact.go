@@ -0,0 +1,197 @@
+package redact
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces sensitive values
+const Mask = "<redacted>"
+
+// minLength is the length under which values are not registered, as masking
+// them would mask common words
+const minLength = 4
+
+// SensitiveFields are the fields of OCP3 configs holding secrets, see
+// RegisterFields
+var SensitiveFields = map[string]bool{
+	"bindPassword": true,
+	"clientSecret": true,
+	"password":     true,
+	"token":        true,
+}
+
+var (
+	// values holds the sensitive values seen during the run, longest first so
+	// that values containing others are masked whole
+	values = struct {
+		sync.RWMutex
+		list []string
+		seen map[string]bool
+	}{seen: make(map[string]bool)}
+
+	// patterns mask secrets never registered, by their shape
+	patterns = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		{regexp.MustCompile(`-----BEGIN ([A-Z ]*)PRIVATE KEY-----[\s\S]*?-----END ([A-Z ]*)PRIVATE KEY-----`), Mask},
+		{regexp.MustCompile(`\$apr1\$[./0-9A-Za-z]*\$[./0-9A-Za-z]+`), Mask},
+		{regexp.MustCompile(`\$2[aby]?\$\d\d\$[./0-9A-Za-z]{53}`), Mask},
+		{regexp.MustCompile(`\{SHA\}[+/0-9A-Za-z]+=*`), Mask},
+		{regexp.MustCompile(`(?i)((?:bindPassword|clientSecret|password|token)\\?["']?\s*[:=]\s*\\?["']?)([^\s"'\\,}]+)`), "${1}" + Mask},
+	}
+)
+
+// Register adds sensitive values, such as passwords or file contents, to
+// mask. Their lines and base64 encodings are masked too.
+func Register(sensitive ...string) {
+	values.Lock()
+	defer values.Unlock()
+
+	for _, value := range sensitive {
+		candidates := []string{value, base64.StdEncoding.EncodeToString([]byte(value))}
+		for _, line := range strings.Split(value, "\n") {
+			candidates = append(candidates, strings.TrimSpace(line))
+		}
+
+		for _, candidate := range candidates {
+			if len(candidate) < minLength || values.seen[candidate] {
+				continue
+			}
+			values.seen[candidate] = true
+			values.list = append(values.list, candidate)
+		}
+	}
+
+	sort.SliceStable(values.list, func(i, j int) bool { return len(values.list[i]) > len(values.list[j]) })
+}
+
+// RegisterFields registers the values of the SensitiveFields of object, a
+// decoded JSON or YAML document, walked recursively. The value of a field can
+// be a string or, as with OCP3 StringSources, an object holding it in value.
+func RegisterFields(object interface{}) {
+	switch object := object.(type) {
+	case map[string]interface{}:
+		for key, value := range object {
+			registerField(key, value)
+		}
+	case map[interface{}]interface{}:
+		for key, value := range object {
+			if key, ok := key.(string); ok {
+				registerField(key, value)
+			}
+		}
+	case []interface{}:
+		for _, value := range object {
+			RegisterFields(value)
+		}
+	}
+}
+
+func registerField(key string, value interface{}) {
+	if !SensitiveFields[key] {
+		RegisterFields(value)
+		return
+	}
+
+	switch value := value.(type) {
+	case string:
+		Register(value)
+	case map[string]interface{}:
+		if v, ok := value["value"].(string); ok {
+			Register(v)
+		}
+	case map[interface{}]interface{}:
+		if v, ok := value["value"].(string); ok {
+			Register(v)
+		}
+	}
+}
+
+// String masks the sensitive values of s
+func String(s string) string {
+	values.RLock()
+	for _, value := range values.list {
+		s = strings.Replace(s, value, Mask, -1)
+	}
+	values.RUnlock()
+
+	for _, pattern := range patterns {
+		s = pattern.re.ReplaceAllString(s, pattern.repl)
+	}
+
+	return s
+}
+
+// redactedError masks the message of an error
+type redactedError struct {
+	err error
+}
+
+// Error masks the sensitive values of the message of err, keeping err
+// available with Unwrap
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(redactedError); ok {
+		return err
+	}
+
+	return redactedError{err: err}
+}
+
+func (e redactedError) Error() string {
+	return String(e.err.Error())
+}
+
+// Unwrap returns the error masked
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+// Hook masks the sensitive values of every log entry, its message and fields.
+// It must be the first hook, so that other hooks and the formatter only see
+// the masked entry.
+type Hook struct{}
+
+// Levels returns all levels
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks the entry
+func (Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = String(entry.Message)
+
+	// Data is shared with the logger the entry comes from, masked in a copy
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			data[key] = String(value)
+		case error:
+			data[key] = String(value.Error())
+		default:
+			data[key] = value
+		}
+	}
+	entry.Data = data
+
+	return nil
+}
+
+// reset forgets the values registered, for tests
+func reset() {
+	values.Lock()
+	defer values.Unlock()
+
+	values.list = nil
+	values.seen = make(map[string]bool)
+}
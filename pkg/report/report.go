@@ -1,10 +1,102 @@
 package report
 
 import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/transform"
 	"github.com/sirupsen/logrus"
 )
 
+// ReportFile is the file of OutputDir the report is written to
+const ReportFile = "report.json"
+
+// Report tells what OCP3 configuration can be recreated on OCP4
+type Report struct {
+	// SourceVersion is the release of the source cluster, "unknown" if it
+	// could not be detected
+	SourceVersion string `json:"sourceVersion"`
+	// Transforms are the names of the transforms reported on
+	Transforms []string `json:"transforms"`
+	// ReferencedFiles are the files the master and node configs refer to
+	ReferencedFiles []string `json:"referencedFiles,omitempty"`
+	// UnreadConfigs are the configs whose references are missing from
+	// ReferencedFiles, with why they could not be read
+	UnreadConfigs map[string]string `json:"unreadConfigs,omitempty"`
+}
+
 //Start generating a component transform confidence report
-func Start() {
-	logrus.Info("Not Implemented")
+func Start() (*Report, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transforms, err := transform.Transforms(&config)
+	if err != nil {
+		return nil, env.ConfigError{Err: err}
+	}
+
+	report := &Report{SourceVersion: "unknown"}
+	if version, err := config.SourceVersion(); err != nil {
+		logrus.Warn(err)
+	} else {
+		report.SourceVersion = version.String()
+	}
+	logrus.Infof("Source version: %s", report.SourceVersion)
+
+	for _, transform := range transforms {
+		report.Transforms = append(report.Transforms, transform.Name())
+	}
+	logrus.Infof("Transforms: %s", strings.Join(report.Transforms, ", "))
+
+	report.ReferencedFiles, err = config.ReferencedFiles()
+	report.UnreadConfigs = unreadConfigs(err)
+	if err != nil && report.UnreadConfigs == nil {
+		logrus.Warnf("Unable to list the referenced files: %v", err)
+	}
+
+	return report, nil
+}
+
+// unreadConfigs returns the configs of the ReferenceErrors of err, nil if none
+func unreadConfigs(err error) map[string]string {
+	var refErrs config.ReferenceErrors
+	if !errors.As(err, &refErrs) {
+		return nil
+	}
+
+	configs := make(map[string]string)
+	for _, refErr := range refErrs {
+		logrus.Warnf("Unable to list the files %s refers to: %v", refErr.File, refErr.Err)
+		configs[refErr.File] = refErr.Err.Error()
+	}
+
+	return configs
+}
+
+// Write writes the report as JSON to dir/ReportFile
+func (r *Report) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, ReportFile)
+	if err := ioutil.WriteFile(file, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Report written to %s", file)
+
+	return nil
 }
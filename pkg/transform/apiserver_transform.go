@@ -0,0 +1,151 @@
+package transform
+
+import (
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// APIServerExtraction holds API server data extracted from OCP3
+type APIServerExtraction struct {
+	// EncryptionConfig is the encryption provider config of the API server
+	EncryptionConfig string
+	// AuditPolicyFile is the audit policy of the API server, when auditing
+	// is enabled
+	AuditPolicyFile string
+	AuditEnabled    bool
+	Target          *config.Target
+}
+
+// APIServerCR is an APIServer Cluster Resource
+type APIServerCR struct {
+	APIVersion string        `yaml:"apiVersion"`
+	Kind       string        `yaml:"kind"`
+	Metadata   Metadata      `yaml:"metadata"`
+	Spec       APIServerSpec `yaml:"spec"`
+}
+
+// APIServerSpec is a Spec for an APIServerCR
+type APIServerSpec struct {
+	Encryption *APIServerEncryption `yaml:"encryption,omitempty"`
+	Audit      *APIServerAudit      `yaml:"audit,omitempty"`
+}
+
+// APIServerEncryption is how the API server encrypts resources in etcd
+type APIServerEncryption struct {
+	Type string `yaml:"type"`
+}
+
+// APIServerAudit is the audit profile of the API server
+type APIServerAudit struct {
+	Profile string `yaml:"profile"`
+}
+
+// APIServerTransform is an API server specific transform
+type APIServerTransform struct {
+	Config *config.Config
+}
+
+// encryptionProviderConfigArgs are the API server arguments of an encryption
+// provider config, the experimental one being used up to 3.11
+var encryptionProviderConfigArgs = []string{"experimental-encryption-provider-config", "encryption-provider-config"}
+
+// Transform converts API server data collected from an OCP3 cluster to an OCP4 CR
+func (e APIServerExtraction) Transform() (Output, error) {
+	logrus.Info("APIServerTransform::Transform")
+
+	const (
+		apiVersion = "config.openshift.io/v1"
+		kind       = "APIServer"
+		name       = "cluster"
+		annokey    = "release.openshift.io/create-only"
+		annoval    = "true"
+		// encryptionType is the only type OCP4 offers, with keys it manages
+		encryptionType = "aescbc"
+		// auditProfile logs the metadata of every request, as OCP3 does
+		// without a policy
+		auditProfile = "Default"
+	)
+
+	var output ManifestOutput
+	var apiServerCR APIServerCR
+	apiServerCR.APIVersion = apiVersion
+	apiServerCR.Kind = kind
+	apiServerCR.Metadata.Name = name
+	apiServerCR.Metadata.Annotations = map[string]string{annokey: annoval}
+
+	if e.EncryptionConfig != "" {
+		if !e.Target.Supports(config.APIServerEncryption) {
+			output.Findings = append(output.Findings, notGenerated(e.Target, config.APIServerEncryption))
+		} else {
+			apiServerCR.Spec.Encryption = &APIServerEncryption{Type: encryptionType}
+			output.Findings = append(output.Findings, "Encryption keys of "+e.EncryptionConfig+" are not migrated, OCP4 generates its own")
+		}
+	}
+
+	if e.AuditEnabled {
+		if !e.Target.Supports(config.APIServerAudit) {
+			output.Findings = append(output.Findings, notGenerated(e.Target, config.APIServerAudit))
+		} else {
+			apiServerCR.Spec.Audit = &APIServerAudit{Profile: auditProfile}
+			if e.AuditPolicyFile != "" {
+				output.Findings = append(output.Findings, "Audit policy "+e.AuditPolicyFile+" is not migrated, OCP4 uses the "+auditProfile+" profile")
+			}
+		}
+	}
+
+	if apiServerCR.Spec.Encryption != nil || apiServerCR.Spec.Audit != nil {
+		apiServerCRYAML, err := yaml.Marshal(&apiServerCR)
+		if err != nil {
+			return nil, err
+		}
+		output.Manifests = append(output.Manifests, Manifest{Name: "100_CPMA-cluster-config-apiserver.yaml", CRD: apiServerCRYAML})
+	}
+	for _, finding := range output.Findings {
+		logrus.Info(finding)
+	}
+
+	return output, nil
+}
+
+// Extract collects API server configuration from an OCP3 cluster
+func (e APIServerTransform) Extract() (Extraction, error) {
+	logrus.Info("APIServerTransform::Extract")
+	masterConfig, err := e.Config.MasterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var extraction APIServerExtraction
+	for _, arg := range encryptionProviderConfigArgs {
+		if values := masterConfig.KubernetesMasterConfig.APIServerArguments[arg]; len(values) > 0 {
+			extraction.EncryptionConfig = values[0]
+			break
+		}
+	}
+	extraction.AuditEnabled = masterConfig.AuditConfig.Enabled
+	if extraction.AuditEnabled {
+		extraction.AuditPolicyFile = masterConfig.AuditConfig.PolicyFile
+	}
+	extraction.Target = e.Config.Target
+
+	return extraction, nil
+}
+
+// Validate API server data collected from an OCP3 cluster
+func (e APIServerExtraction) Validate() error {
+	if e.EncryptionConfig == "" && !e.AuditEnabled {
+		return NothingToMigrate{Reason: "no encryption nor auditing configured, not generating a cr"}
+	}
+	return nil
+}
+
+// Name returns a human readable name for the transform
+func (e APIServerTransform) Name() string {
+	return "APIServer"
+}
+
+// Description tells what the transform migrates
+func (e APIServerTransform) Description() string {
+	return "Enables the encryption of resources in etcd and auditing when the OCP3 API server has them"
+}
@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIServerExtractionTransform(t *testing.T) {
+	expectedCR := `apiVersion: config.openshift.io/v1
+kind: APIServer
+metadata:
+  name: cluster
+  annotations:
+    release.openshift.io/create-only: "true"
+spec:
+  encryption:
+    type: aescbc
+`
+
+	testCases := []struct {
+		name              string
+		targetVersion     string
+		expectedManifests []Manifest
+		expectedMissing   []config.Feature
+	}{
+		{
+			name:          "enable encryption",
+			targetVersion: "4.3",
+			expectedManifests: []Manifest{
+				{Name: "100_CPMA-cluster-config-apiserver.yaml", CRD: []byte(expectedCR)},
+			},
+		},
+		{
+			name:            "leave encryption out before 4.3",
+			targetVersion:   "4.2",
+			expectedMissing: []config.Feature{config.APIServerEncryption},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := config.NewTarget(tc.targetVersion)
+			require.NoError(t, err)
+
+			extraction := APIServerExtraction{
+				EncryptionConfig: "/etc/origin/master/encryption-config.yaml",
+				Target:           target,
+			}
+			require.NoError(t, extraction.Validate())
+
+			output, err := extraction.Transform()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedManifests, output.(ManifestOutput).Manifests)
+			assert.Equal(t, tc.expectedMissing, target.Unsupported())
+		})
+	}
+}
+
+func TestAPIServerExtractionAudit(t *testing.T) {
+	expectedCR := `apiVersion: config.openshift.io/v1
+kind: APIServer
+metadata:
+  name: cluster
+  annotations:
+    release.openshift.io/create-only: "true"
+spec:
+  audit:
+    profile: Default
+`
+
+	testCases := []struct {
+		name              string
+		targetVersion     string
+		expectedManifests []Manifest
+		expectedFindings  []string
+		expectedMissing   []config.Feature
+	}{
+		{
+			name:          "enable auditing",
+			targetVersion: "4.6",
+			expectedManifests: []Manifest{
+				{Name: "100_CPMA-cluster-config-apiserver.yaml", CRD: []byte(expectedCR)},
+			},
+			expectedFindings: []string{"Audit policy /etc/origin/master/audit-policy.yaml is not migrated, OCP4 uses the Default profile"},
+		},
+		{
+			name:             "leave auditing out before 4.6",
+			targetVersion:    "4.5",
+			expectedFindings: []string{"APIServer spec.audit not generated, it needs OCP 4.6 or later, not 4.5"},
+			expectedMissing:  []config.Feature{config.APIServerAudit},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := config.NewTarget(tc.targetVersion)
+			require.NoError(t, err)
+
+			extraction := APIServerExtraction{
+				AuditEnabled:    true,
+				AuditPolicyFile: "/etc/origin/master/audit-policy.yaml",
+				Target:          target,
+			}
+			require.NoError(t, extraction.Validate())
+
+			output, err := extraction.Transform()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedManifests, output.(ManifestOutput).Manifests)
+			assert.Equal(t, tc.expectedFindings, output.(ManifestOutput).Findings)
+			assert.Equal(t, tc.expectedMissing, target.Unsupported())
+		})
+	}
+}
+
+func TestAPIServerExtractionValidate(t *testing.T) {
+	err := APIServerExtraction{}.Validate()
+	assert.IsType(t, NothingToMigrate{}, err)
+}
@@ -0,0 +1,175 @@
+package transform
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dependent is implemented by transforms which need other transforms, referred
+// by their Name(), to complete before they can run
+type Dependent interface {
+	DependsOn() []string
+}
+
+// FactProducer is implemented by transforms which store facts for others to use
+type FactProducer interface {
+	Produces() []string
+}
+
+// FactConsumer is implemented by transforms which read facts stored by others.
+// A transform consuming a fact depends on every transform producing it.
+type FactConsumer interface {
+	Consumes() []string
+}
+
+// FactUser is implemented by FactProducers and FactConsumers, given the fact
+// store of the run before it starts
+type FactUser interface {
+	// WithFacts returns a copy of the transform using facts
+	WithFacts(facts *Facts) Transform
+}
+
+// Facts holds data shared between transforms, keyed by fact name
+type Facts struct {
+	mutex  sync.RWMutex
+	values map[string]interface{}
+}
+
+// NewFacts creates an empty fact store
+func NewFacts() *Facts {
+	return &Facts{values: make(map[string]interface{})}
+}
+
+// Set stores a fact
+func (f *Facts) Set(name string, value interface{}) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[name] = value
+}
+
+// Get returns a fact and whether it was set
+func (f *Facts) Get(name string) (interface{}, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	value, ok := f.values[name]
+	return value, ok
+}
+
+// withFacts returns transforms, each FactUser being given facts
+func withFacts(transforms []Transform, facts *Facts) []Transform {
+	users := make([]Transform, len(transforms))
+	for i, transform := range transforms {
+		if user, ok := transform.(FactUser); ok {
+			transform = user.WithFacts(facts)
+		}
+		users[i] = transform
+	}
+
+	return users
+}
+
+// sortTransforms orders transforms so that each one comes after its
+// prerequisites. Ties keep the order transforms were given in.
+// It returns the order as indexes into transforms, the prerequisites of each
+// transform and, for transforms which cannot run, the reason why.
+func sortTransforms(transforms []Transform) ([]int, [][]int, []error) {
+	n := len(transforms)
+	deps := make([][]int, n)
+	errs := make([]error, n)
+
+	byName := make(map[string]int)
+	producers := make(map[string][]int)
+	for i, transform := range transforms {
+		if _, ok := byName[transform.Name()]; !ok {
+			byName[transform.Name()] = i
+		}
+		if producer, ok := transform.(FactProducer); ok {
+			for _, fact := range producer.Produces() {
+				producers[fact] = append(producers[fact], i)
+			}
+		}
+	}
+
+	for i, transform := range transforms {
+		seen := make(map[int]bool)
+		addDep := func(d int) {
+			if d != i && !seen[d] {
+				seen[d] = true
+				deps[i] = append(deps[i], d)
+			}
+		}
+
+		if dependent, ok := transform.(Dependent); ok {
+			for _, name := range dependent.DependsOn() {
+				d, ok := byName[name]
+				if !ok {
+					errs[i] = errors.New("unknown dependency " + name)
+					break
+				}
+				addDep(d)
+			}
+		}
+
+		if consumer, ok := transform.(FactConsumer); ok {
+			for _, fact := range consumer.Consumes() {
+				for _, d := range producers[fact] {
+					addDep(d)
+				}
+			}
+		}
+		sort.Ints(deps[i])
+	}
+
+	// Kahn's algorithm, always picking the first ready transform
+	indegree := make([]int, n)
+	dependents := make([][]int, n)
+	for i := range transforms {
+		indegree[i] = len(deps[i])
+		for _, d := range deps[i] {
+			dependents[d] = append(dependents[d], i)
+		}
+	}
+
+	order := make([]int, 0, n)
+	sorted := make([]bool, n)
+	for len(order) < n {
+		next := -1
+		for i := range transforms {
+			if !sorted[i] && indegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			break
+		}
+
+		sorted[next] = true
+		order = append(order, next)
+		for _, d := range dependents[next] {
+			indegree[d]--
+		}
+	}
+
+	// Whatever is left is part of, or depends on, a cycle
+	if len(order) < n {
+		var names []string
+		for i, transform := range transforms {
+			if !sorted[i] {
+				names = append(names, transform.Name())
+			}
+		}
+
+		cycleErr := errors.New("dependency cycle detected between " + strings.Join(names, ", "))
+		for i := range transforms {
+			if !sorted[i] {
+				order = append(order, i)
+				errs[i] = cycleErr
+			}
+		}
+	}
+
+	return order, deps, errs
+}
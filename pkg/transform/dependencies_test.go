@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphTransform struct {
+	name      string
+	dependsOn []string
+	produces  []string
+	consumes  []string
+}
+
+func (t graphTransform) Extract() (Extraction, error) {
+	return nil, nil
+}
+
+func (t graphTransform) Name() string {
+	return t.name
+}
+
+func (t graphTransform) DependsOn() []string {
+	return t.dependsOn
+}
+
+func (t graphTransform) Produces() []string {
+	return t.produces
+}
+
+func (t graphTransform) Consumes() []string {
+	return t.consumes
+}
+
+func TestSortTransforms(t *testing.T) {
+	testCases := []struct {
+		name          string
+		transforms    []Transform
+		expectedOrder []int
+		expectedDeps  [][]int
+		expectedErrs  []error
+	}{
+		{
+			name: "keep given order without dependencies",
+			transforms: []Transform{
+				graphTransform{name: "OAuth"},
+				graphTransform{name: "SDN"},
+				graphTransform{name: "Registries"},
+			},
+			expectedOrder: []int{0, 1, 2},
+			expectedDeps:  [][]int{nil, nil, nil},
+			expectedErrs:  []error{nil, nil, nil},
+		},
+		{
+			name: "order by declared dependencies",
+			transforms: []Transform{
+				graphTransform{name: "Image", dependsOn: []string{"Registries"}},
+				graphTransform{name: "SDN"},
+				graphTransform{name: "Registries"},
+			},
+			expectedOrder: []int{1, 2, 0},
+			expectedDeps:  [][]int{{2}, nil, nil},
+			expectedErrs:  []error{nil, nil, nil},
+		},
+		{
+			name: "order by consumed facts",
+			transforms: []Transform{
+				graphTransform{name: "Scheduler", consumes: []string{"defaultNodeSelector"}},
+				graphTransform{name: "Project", produces: []string{"defaultNodeSelector"}},
+			},
+			expectedOrder: []int{1, 0},
+			expectedDeps:  [][]int{{1}, nil},
+			expectedErrs:  []error{nil, nil},
+		},
+		{
+			name: "fail unknown dependency",
+			transforms: []Transform{
+				graphTransform{name: "Image", dependsOn: []string{"ImagePolicy"}},
+			},
+			expectedOrder: []int{0},
+			expectedDeps:  [][]int{nil},
+			expectedErrs:  []error{errors.New("unknown dependency ImagePolicy")},
+		},
+		{
+			name: "detect cycles",
+			transforms: []Transform{
+				graphTransform{name: "A", dependsOn: []string{"B"}},
+				graphTransform{name: "B", dependsOn: []string{"A"}},
+				graphTransform{name: "C"},
+			},
+			expectedOrder: []int{2, 0, 1},
+			expectedDeps:  [][]int{{1}, {0}, nil},
+			expectedErrs: []error{
+				errors.New("dependency cycle detected between A, B"),
+				errors.New("dependency cycle detected between A, B"),
+				nil,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			order, deps, errs := sortTransforms(tc.transforms)
+			assert.Equal(t, tc.expectedOrder, order)
+			assert.Equal(t, tc.expectedDeps, deps)
+			assert.Equal(t, tc.expectedErrs, errs)
+		})
+	}
+}
+
+func TestFacts(t *testing.T) {
+	facts := NewFacts()
+
+	_, ok := facts.Get("defaultNodeSelector")
+	assert.False(t, ok)
+
+	facts.Set("defaultNodeSelector", "node-role.kubernetes.io/compute=true")
+	value, ok := facts.Get("defaultNodeSelector")
+	assert.True(t, ok)
+	assert.Equal(t, "node-role.kubernetes.io/compute=true", value)
+}
+
+// factTransform stores value as fact, or reads fact into read
+type factTransform struct {
+	fakeTransform
+	fact    string
+	value   string
+	consume bool
+	read    *string
+	facts   *Facts
+}
+
+func (t factTransform) Extract() (Extraction, error) {
+	if t.consume {
+		value, _ := t.facts.Get(t.fact)
+		*t.read, _ = value.(string)
+	} else {
+		t.facts.Set(t.fact, t.value)
+	}
+
+	return t.fakeTransform.Extract()
+}
+
+func (t factTransform) Produces() []string {
+	if t.consume {
+		return nil
+	}
+	return []string{t.fact}
+}
+
+func (t factTransform) Consumes() []string {
+	if t.consume {
+		return []string{t.fact}
+	}
+	return nil
+}
+
+func (t factTransform) WithFacts(facts *Facts) Transform {
+	t.facts = facts
+	return t
+}
+
+func TestRunnerFacts(t *testing.T) {
+	var flushed []string
+	var flushMutex sync.Mutex
+	var running, maxRunning int32
+	fake := func(name string) fakeTransform {
+		return fakeTransform{name: name, flushed: &flushed, flushMutex: &flushMutex, running: &running, maxRunning: &maxRunning}
+	}
+
+	var read string
+	runner := Runner{Workers: 2}
+	err := runner.Transform([]Transform{
+		factTransform{fakeTransform: fake("Registries"), fact: FactImagePolicy, consume: true, read: &read},
+		factTransform{fakeTransform: fake("ImagePolicy"), fact: FactImagePolicy, value: "registry.example.com"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "registry.example.com", read)
+	assert.Equal(t, []string{"ImagePolicy", "Registries"}, flushed)
+}
@@ -0,0 +1,122 @@
+package transform
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+)
+
+// FetchResult is the outcome of fetching a file
+type FetchResult struct {
+	Host string
+	Path string
+	Size int64
+	Err  error
+}
+
+// Fetch retrieves every file the selected transforms need, and every file the
+// master and node configs refer to, into OutputDir, without translating
+// anything, so they can run offline later
+func Fetch() ([]FetchResult, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encrypt.NewEncrypter(config.EncryptionKeys); err != nil {
+		return nil, env.ConfigError{Err: err}
+	}
+	selected, err := Transforms(&config)
+	if err != nil {
+		return nil, env.ConfigError{Err: err}
+	}
+	runner := NewRunner(config)
+	runner.detectVersion(&config)
+
+	err = runner.Extract(selected)
+	if _, refErr := config.FetchReferencedFiles(); refErr != nil && err == nil {
+		err = refErr
+	}
+
+	return fetchResults(&config), err
+}
+
+// fetchResults lists the files fetched, or which could not be, by host and path
+func fetchResults(config *config.Config) []FetchResult {
+	var results []FetchResult
+
+	for _, file := range config.Cache.UsedFiles() {
+		result := newFetchResult(file, nil)
+		if info, err := os.Stat(config.LocalPath(result.Path)); err == nil {
+			result.Size = info.Size()
+		}
+		results = append(results, result)
+	}
+
+	for file, err := range config.Cache.FailedFiles() {
+		results = append(results, newFetchResult(file, err))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Host != results[j].Host {
+			return results[i].Host < results[j].Host
+		}
+		return results[i].Path < results[j].Path
+	})
+
+	return results
+}
+
+// newFetchResult splits file, as <Hostname>:<path>
+func newFetchResult(file string, err error) FetchResult {
+	parts := strings.SplitN(file, ":", 2)
+	result := FetchResult{Host: parts[0], Err: err}
+	if len(parts) == 2 {
+		result.Path = parts[1]
+	}
+
+	return result
+}
+
+// Status is "ok", or why the file could not be fetched
+func (r FetchResult) Status() string {
+	if r.Err == nil {
+		return "ok"
+	}
+	if fetchErr, ok := sftpclient.AsFetchError(r.Err); ok {
+		return fetchErr.Kind.String()
+	}
+
+	return "error"
+}
+
+// PrintFetchSummary writes results as a table
+func PrintFetchSummary(w io.Writer, results []FetchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tPATH\tSIZE\tSTATUS")
+
+	failed := 0
+	for _, result := range results {
+		size := "-"
+		if result.Err == nil {
+			size = fmt.Sprintf("%d", result.Size)
+		} else {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Host, result.Path, size, result.Status())
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d files fetched, %d failed\n", len(results)-failed, failed)
+	return err
+}
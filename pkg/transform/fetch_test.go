@@ -0,0 +1,69 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerExtract(t *testing.T) {
+	var flushed []string
+	var flushMutex sync.Mutex
+	var running, maxRunning int32
+
+	var transforms []Transform
+	for _, name := range []string{"OAuth", "SDN"} {
+		var extractErr error
+		if name == "SDN" {
+			extractErr = errors.New("unreachable")
+		}
+		transforms = append(transforms, fakeTransform{
+			name:       name,
+			extractErr: extractErr,
+			flushed:    &flushed,
+			flushMutex: &flushMutex,
+			running:    &running,
+			maxRunning: &maxRunning,
+		})
+	}
+
+	runner := Runner{Workers: 2}
+	err := runner.Extract(transforms)
+	require.Error(t, err)
+	assert.Equal(t, TransformErrors{{Transform: "SDN", Err: errors.New("unreachable")}}, err)
+	assert.Empty(t, flushed)
+}
+
+func TestPrintFetchSummary(t *testing.T) {
+	results := []FetchResult{
+		{
+			Host: "master-0.example.com",
+			Path: "/etc/origin/master/htpasswd",
+			Err: &sftpclient.FetchError{
+				Kind: sftpclient.PermissionError,
+				Host: "master-0.example.com",
+				Path: "/etc/origin/master/htpasswd",
+				Err:  os.ErrPermission,
+			},
+		},
+		{
+			Host: "master-0.example.com",
+			Path: "/etc/origin/master/master-config.yaml",
+			Size: 5342,
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, PrintFetchSummary(&out, results))
+	assert.Equal(t, `HOST                  PATH                                   SIZE  STATUS
+master-0.example.com  /etc/origin/master/htpasswd            -     permission denied
+master-0.example.com  /etc/origin/master/master-config.yaml  5342  ok
+1 files fetched, 1 failed
+`, out.String())
+}
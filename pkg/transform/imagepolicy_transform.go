@@ -0,0 +1,107 @@
+package transform
+
+import (
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// FactImagePolicy is the fact holding the ImagePolicy of the master config,
+// merged into the Image CR by the registries transform
+const FactImagePolicy = "imagePolicy"
+
+// ImagePolicy holds the imagePolicyConfig settings of an OCP3 master
+type ImagePolicy struct {
+	AllowedRegistriesForImport []RegistryLocation
+	ExternalRegistryHostname   string
+	InternalRegistryHostname   string
+	AdditionalTrustedCA        string
+}
+
+// RegistryLocation is a registry images can be imported from
+type RegistryLocation struct {
+	DomainName string `yaml:"domainName"`
+	Insecure   bool   `yaml:"insecure,omitempty"`
+}
+
+// ImagePolicyExtraction holds the image policy extracted from OCP3
+type ImagePolicyExtraction struct {
+	ImagePolicy ImagePolicy
+}
+
+// ImagePolicyTransform extracts the image policy of the master config, for
+// the registries transform to merge into the Image CR
+type ImagePolicyTransform struct {
+	Config *config.Config
+	Facts  *Facts
+}
+
+// Transform reports the settings OCP4 has no place for, the others are
+// generated by the registries transform
+func (e ImagePolicyExtraction) Transform() (Output, error) {
+	logrus.Info("ImagePolicyTransform::Transform")
+
+	var output ManifestOutput
+	if e.ImagePolicy.InternalRegistryHostname != "" {
+		output.Findings = append(output.Findings, "Internal registry hostname "+e.ImagePolicy.InternalRegistryHostname+" is not migrated, OCP4 sets its own")
+	}
+	if e.ImagePolicy.AdditionalTrustedCA != "" {
+		output.Findings = append(output.Findings, "Additional trusted CA "+e.ImagePolicy.AdditionalTrustedCA+" is not migrated, set it in a ConfigMap referenced by the Image CR")
+	}
+
+	return output, nil
+}
+
+// Extract collects the image policy of an OCP3 master and stores it as
+// FactImagePolicy
+func (e ImagePolicyTransform) Extract() (Extraction, error) {
+	logrus.Info("ImagePolicyTransform::Extract")
+	masterConfig, err := e.Config.MasterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	policyConfig := masterConfig.ImagePolicyConfig
+	policy := ImagePolicy{
+		ExternalRegistryHostname: policyConfig.ExternalRegistryHostname,
+		InternalRegistryHostname: policyConfig.InternalRegistryHostname,
+		AdditionalTrustedCA:      policyConfig.AdditionalTrustedCA,
+	}
+	if policyConfig.AllowedRegistriesForImport != nil {
+		for _, location := range *policyConfig.AllowedRegistriesForImport {
+			policy.AllowedRegistriesForImport = append(policy.AllowedRegistriesForImport,
+				RegistryLocation{DomainName: location.DomainName, Insecure: location.Insecure})
+		}
+	}
+
+	if e.Facts != nil {
+		e.Facts.Set(FactImagePolicy, policy)
+	}
+
+	return ImagePolicyExtraction{ImagePolicy: policy}, nil
+}
+
+// Validate the image policy collected from an OCP3 cluster
+func (e ImagePolicyExtraction) Validate() error {
+	return nil
+}
+
+// Name returns a human readable name for the transform
+func (e ImagePolicyTransform) Name() string {
+	return "ImagePolicy"
+}
+
+// Description tells what the transform migrates
+func (e ImagePolicyTransform) Description() string {
+	return "Merges the registries images can be imported from and the external registry hostname into the Image CR"
+}
+
+// Produces returns the facts the transform stores
+func (e ImagePolicyTransform) Produces() []string {
+	return []string{FactImagePolicy}
+}
+
+// WithFacts returns the transform storing its facts in facts
+func (e ImagePolicyTransform) WithFacts(facts *Facts) Transform {
+	e.Facts = facts
+	return e
+}
@@ -0,0 +1,250 @@
+package transform
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// KustomizationFile is the name of the kustomize configuration of a directory
+const KustomizationFile = "kustomization.yaml"
+
+// componentKinds are the components the kinds of objects belong to, objects of
+// other kinds getting a component of their own. The ConfigMaps and secrets cpma
+// generates are for identity providers.
+var componentKinds = map[string]string{
+	"OAuth":                  "oauth",
+	"ConfigMap":              "oauth",
+	"Secret":                 "oauth",
+	"SealedSecret":           "oauth",
+	"ExternalSecret":         "oauth",
+	"Network":                "network",
+	"Image":                  "image",
+	"KubeletConfig":          "node",
+	"ContainerRuntimeConfig": "node",
+}
+
+// Kustomization is a kustomization.yaml file
+type Kustomization struct {
+	APIVersion       string            `yaml:"apiVersion"`
+	Kind             string            `yaml:"kind"`
+	Resources        []string          `yaml:"resources,omitempty"`
+	GeneratorOptions *GeneratorOptions `yaml:"generatorOptions,omitempty"`
+	SecretGenerator  []SecretGenerator `yaml:"secretGenerator,omitempty"`
+}
+
+// GeneratorOptions are the options of the generators of a kustomization
+type GeneratorOptions struct {
+	DisableNameSuffixHash bool `yaml:"disableNameSuffixHash"`
+}
+
+// SecretGenerator generates a secret from files
+type SecretGenerator struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace,omitempty"`
+	Type      string   `yaml:"type,omitempty"`
+	Files     []string `yaml:"files"`
+}
+
+// kustomizeWriter writes manifests into OutputDir/kustomize, a directory per
+// component with its kustomization.yaml, and a kustomization.yaml including
+// them all. Secrets are generated from their data, written as files next to
+// the manifests, so that they can be kept out of version control or replaced
+// by overlays. They are not encrypted, the secret generators reading them as
+// they are.
+type kustomizeWriter struct {
+	dir string
+	// kustomizations holds the kustomization of each component
+	kustomizations map[string]*Kustomization
+}
+
+func newKustomizeWriter(options WriterOptions) (Writer, error) {
+	if options.Encrypter != nil {
+		return nil, errors.New("secrets cannot be encrypted with the kustomize output format, their generators reading them in clear, use another output format")
+	}
+
+	return &kustomizeWriter{
+		dir:            filepath.Join(options.OutputDir, "kustomize"),
+		kustomizations: make(map[string]*Kustomization),
+	}, nil
+}
+
+func (w *kustomizeWriter) Write(manifests []Manifest) error {
+	for _, manifest := range manifests {
+		if err := w.writeManifest(manifest); err != nil {
+			return errors.New(manifest.Name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Close writes the kustomizations
+func (w *kustomizeWriter) Close() error {
+	components := make([]string, 0, len(w.kustomizations))
+	for component, kustomization := range w.kustomizations {
+		if err := writeKustomization(filepath.Join(w.dir, component), kustomization); err != nil {
+			return err
+		}
+		components = append(components, component)
+	}
+	sort.Strings(components)
+
+	return writeKustomization(w.dir, newKustomization(components))
+}
+
+func newKustomization(resources []string) *Kustomization {
+	return &Kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  resources,
+	}
+}
+
+// writeManifest writes manifest into the directory of its component, adding
+// it to the component kustomization
+func (w *kustomizeWriter) writeManifest(manifest Manifest) error {
+	content, err := k8syaml.ToJSON(manifest.CRD)
+	if err != nil {
+		return err
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(content, &object); err != nil {
+		return err
+	}
+
+	kind, _ := object["kind"].(string)
+	if kind == "" {
+		return errors.New("missing kind")
+	}
+
+	component, ok := componentKinds[kind]
+	if !ok {
+		component = strings.ToLower(kind)
+	}
+	kustomization, ok := w.kustomizations[component]
+	if !ok {
+		kustomization = newKustomization(nil)
+		w.kustomizations[component] = kustomization
+	}
+
+	componentDir := filepath.Join(w.dir, component)
+	if kind == "Secret" {
+		generator, err := w.writeSecretFiles(componentDir, object)
+		if err != nil {
+			return err
+		}
+		// Manifests refer to secrets by the name cpma gave them
+		kustomization.GeneratorOptions = &GeneratorOptions{DisableNameSuffixHash: true}
+		kustomization.SecretGenerator = addSecretGenerator(kustomization.SecretGenerator, generator)
+		return nil
+	}
+
+	if err := os.MkdirAll(componentDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(componentDir, manifest.Name), manifest.CRD, 0644); err != nil {
+		return err
+	}
+	logrus.Printf("Kustomize:Added: %s", filepath.Join(componentDir, manifest.Name))
+	kustomization.Resources = addResource(kustomization.Resources, manifest.Name)
+
+	return nil
+}
+
+// writeSecretFiles writes the data of a secret into files of
+// dir/secrets/<name>, returning the generator of the secret
+func (w *kustomizeWriter) writeSecretFiles(dir string, secret map[string]interface{}) (SecretGenerator, error) {
+	metadata, _ := secret["metadata"].(map[string]interface{})
+	generator := SecretGenerator{}
+	generator.Name, _ = metadata["name"].(string)
+	generator.Namespace, _ = metadata["namespace"].(string)
+	generator.Type, _ = secret["type"].(string)
+	if generator.Name == "" {
+		return generator, errors.New("missing secret name")
+	}
+
+	secretDir := filepath.Join(dir, "secrets", generator.Name)
+	if err := os.MkdirAll(secretDir, 0700); err != nil {
+		return generator, err
+	}
+
+	files := make(map[string][]byte)
+	data, _ := secret["data"].(map[string]interface{})
+	for key, value := range data {
+		encoded, _ := value.(string)
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			logrus.Warnf("Kustomize: data %s of secret %s is not base64 encoded, written as is", key, generator.Name)
+			decoded = []byte(encoded)
+		}
+		files[key] = decoded
+	}
+	stringData, _ := secret["stringData"].(map[string]interface{})
+	for key, value := range stringData {
+		content, _ := value.(string)
+		files[key] = []byte(content)
+	}
+
+	for key, content := range files {
+		if err := encrypt.WriteFile(filepath.Join(secretDir, key), content, nil); err != nil {
+			return generator, err
+		}
+		generator.Files = append(generator.Files, filepath.ToSlash(filepath.Join("secrets", generator.Name, key)))
+	}
+	sort.Strings(generator.Files)
+	logrus.Printf("Kustomize:Added: %s", secretDir)
+
+	return generator, nil
+}
+
+// addResource adds resource to resources once, keeping them sorted
+func addResource(resources []string, resource string) []string {
+	for _, r := range resources {
+		if r == resource {
+			return resources
+		}
+	}
+	resources = append(resources, resource)
+	sort.Strings(resources)
+
+	return resources
+}
+
+// addSecretGenerator adds or replaces the generator of a secret, keeping them
+// sorted by name
+func addSecretGenerator(generators []SecretGenerator, generator SecretGenerator) []SecretGenerator {
+	for i, g := range generators {
+		if g.Name == generator.Name && g.Namespace == generator.Namespace {
+			generators[i] = generator
+			return generators
+		}
+	}
+	generators = append(generators, generator)
+	sort.Slice(generators, func(i, j int) bool { return generators[i].Name < generators[j].Name })
+
+	return generators
+}
+
+func writeKustomization(dir string, kustomization *Kustomization) error {
+	content, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, KustomizationFile), content, 0644)
+}
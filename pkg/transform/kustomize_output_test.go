@@ -0,0 +1,99 @@
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKustomizeWriter(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-kustomize")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	writer, err := NewWriter("kustomize", WriterOptions{OutputDir: outputDir})
+	require.NoError(t, err)
+
+	oauth := `apiVersion: config.openshift.io/v1
+kind: OAuth
+metadata:
+  name: cluster
+spec:
+  identityProviders:
+  - name: htpasswd_auth
+    type: HTPasswd
+    htpasswd:
+      fileData:
+        name: htpasswd_auth-secret
+`
+	secret := `apiVersion: v1
+kind: Secret
+type: Opaque
+metadata:
+  name: htpasswd_auth-secret
+  namespace: openshift-config
+data:
+  htpasswd: dXNlcjpwYXNzd29yZA==
+`
+	network := `apiVersion: operator.openshift.io/v1
+kind: Network
+spec:
+  serviceNetwork: 172.30.0.0/16
+`
+
+	require.NoError(t, writer.Write([]Manifest{
+		{Name: "100_CPMA-cluster-config-oauth.yaml", CRD: []byte(oauth)},
+		{Name: "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml", CRD: []byte(secret)},
+	}))
+	require.NoError(t, writer.Write([]Manifest{
+		{Name: "100_CPMA-cluster-config-sdn.yaml", CRD: []byte(network)},
+	}))
+	require.NoError(t, writer.Close())
+
+	dir := filepath.Join(outputDir, "kustomize")
+	content, err := ioutil.ReadFile(filepath.Join(dir, KustomizationFile))
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- network
+- oauth
+`, string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "oauth", KustomizationFile))
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- 100_CPMA-cluster-config-oauth.yaml
+generatorOptions:
+  disableNameSuffixHash: true
+secretGenerator:
+- name: htpasswd_auth-secret
+  namespace: openshift-config
+  type: Opaque
+  files:
+  - secrets/htpasswd_auth-secret/htpasswd
+`, string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "oauth", "secrets", "htpasswd_auth-secret", "htpasswd"))
+	require.NoError(t, err)
+	assert.Equal(t, "user:password", string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "network", "100_CPMA-cluster-config-sdn.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, network, string(content))
+
+	_, err = os.Stat(filepath.Join(dir, "oauth", "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml"))
+	assert.True(t, os.IsNotExist(err), "secrets are generated, not written as manifests")
+}
+
+func TestKustomizeWriterEncrypted(t *testing.T) {
+	_, err := NewWriter("kustomize", WriterOptions{OutputDir: "output", Encrypter: &encrypt.Encrypter{}})
+	assert.EqualError(t, err, "secrets cannot be encrypted with the kustomize output format, their generators reading them in clear, use another output format")
+}
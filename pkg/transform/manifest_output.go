@@ -1,40 +1,29 @@
 package transform
 
-import (
-	"io/ioutil"
-	"os"
-	"path"
-	"path/filepath"
-
-	"github.com/fusor/cpma/pkg/env"
-	"github.com/sirupsen/logrus"
-)
+import "errors"
 
 // ManifestOutput holds a collection of manifests to be written to fil
 type ManifestOutput struct {
 	Manifests []Manifest
+	// Findings are reported in the run summary
+	Findings []string
 }
 
-var manifestOutputFlush = func(manifests []Manifest) error {
-	logrus.Info("Flushing manifests to disk")
-	DumpManifests(manifests)
-	return nil
-}
+// Flush manifests to writer
+func (m ManifestOutput) Flush(writer Writer) error {
+	if writer == nil {
+		return errors.New("no output writer")
+	}
 
-// Flush manifests to files
-func (m ManifestOutput) Flush() error {
-	return manifestOutputFlush(m.Manifests)
+	return writer.Write(m.Manifests)
 }
 
-// DumpManifests creates OCDs files
-func DumpManifests(manifests []Manifest) {
-	for _, manifest := range manifests {
-		maniftestfile := filepath.Join(env.Config().GetString("OutputDir"), "manifests", manifest.Name)
-		os.MkdirAll(path.Dir(maniftestfile), 0755)
-		err := ioutil.WriteFile(maniftestfile, manifest.CRD, 0644)
-		logrus.Printf("CRD:Added: %s", maniftestfile)
-		if err != nil {
-			logrus.Panic(err)
-		}
+// Describe returns the names of the manifests and the findings
+func (m ManifestOutput) Describe() ([]string, []string) {
+	files := make([]string, 0, len(m.Manifests))
+	for _, manifest := range m.Manifests {
+		files = append(files, manifest.Name)
 	}
+
+	return files, m.Findings
 }
@@ -1,8 +1,6 @@
 package oauth
 
 import (
-	"encoding/base64"
-
 	"github.com/fusor/cpma/pkg/transform/configmaps"
 	"github.com/fusor/cpma/pkg/transform/secrets"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
@@ -25,18 +23,18 @@ type BasicAuth struct {
 	TLSClientKey  *TLSClientKey  `yaml:"tlsClientKey,omitempty"`
 }
 
-func buildBasicAuthIP(serializer *json.Serializer, p IdentityProvider) (*IdentityProviderBasicAuth, *secrets.Secret, *secrets.Secret, *configmaps.ConfigMap, error) {
+func buildBasicAuthIP(serializer *json.Serializer, p IdentityProvider) (*IdentityProviderBasicAuth, *secrets.Secret, *configmaps.ConfigMap, error) {
 	var (
-		err                   error
-		idP                   = &IdentityProviderBasicAuth{}
-		certSecret, keySecret *secrets.Secret
-		caConfigmap           *configmaps.ConfigMap
-		basicAuth             configv1.BasicAuthPasswordIdentityProvider
+		err         error
+		idP         = &IdentityProviderBasicAuth{}
+		tlsSecret   *secrets.Secret
+		caConfigmap *configmaps.ConfigMap
+		basicAuth   configv1.BasicAuthPasswordIdentityProvider
 	)
 
 	_, _, err = serializer.Decode(p.Provider.Raw, nil, &basicAuth)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	idP.Type = "BasicAuth"
@@ -52,24 +50,15 @@ func buildBasicAuthIP(serializer *json.Serializer, p IdentityProvider) (*Identit
 	}
 
 	if basicAuth.CertFile != "" {
-		certSecretName := p.Name + "-client-cert-secret"
-		idP.BasicAuth.TLSClientCert = &TLSClientCert{Name: certSecretName}
-
-		encoded := base64.StdEncoding.EncodeToString(p.CrtData)
-		certSecret, err = secrets.GenSecret(certSecretName, encoded, OAuthNamespace, secrets.BasicAuthSecretType)
+		tlsSecretName := p.Name + "-client-tls-secret"
+		tlsSecret, err = secrets.GenTLSSecret(tlsSecretName, OAuthNamespace, p.CrtData, p.KeyData)
 		if err != nil {
-			return nil, nil, nil, nil, err
+			return nil, nil, nil, err
 		}
 
-		keySecretName := p.Name + "-client-key-secret"
-		idP.BasicAuth.TLSClientKey = &TLSClientKey{Name: keySecretName}
-
-		encoded = base64.StdEncoding.EncodeToString(p.KeyData)
-		keySecret, err = secrets.GenSecret(keySecretName, encoded, OAuthNamespace, secrets.BasicAuthSecretType)
-		if err != nil {
-			return nil, nil, nil, nil, err
-		}
+		idP.BasicAuth.TLSClientCert = &TLSClientCert{Name: tlsSecretName}
+		idP.BasicAuth.TLSClientKey = &TLSClientKey{Name: tlsSecretName}
 	}
 
-	return idP, certSecret, keySecret, caConfigmap, nil
+	return idP, tlsSecret, caConfigmap, nil
 }
@@ -20,6 +20,11 @@ func TestTransformMasterConfigBasicAuth(t *testing.T) {
 	content, err := ioutil.ReadFile(file)
 	require.NoError(t, err)
 
+	crtContent, err := ioutil.ReadFile("../testdata/client.crt")
+	require.NoError(t, err)
+	keyContent, err := ioutil.ReadFile("../testdata/client.key")
+	require.NoError(t, err)
+
 	serializer := k8sjson.NewYAMLSerializer(k8sjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 	var masterV3 configv1.MasterConfig
 
@@ -44,6 +49,8 @@ func TestTransformMasterConfigBasicAuth(t *testing.T) {
 				Name:            identityProvider.Name,
 				Provider:        identityProvider.Provider,
 				HTFileName:      provider.File,
+				CrtData:         crtContent,
+				KeyData:         keyContent,
 				UseAsChallenger: identityProvider.UseAsChallenger,
 				UseAsLogin:      identityProvider.UseAsLogin,
 			})
@@ -62,8 +69,8 @@ func TestTransformMasterConfigBasicAuth(t *testing.T) {
 	basicAuthIDP.Name = "my_remote_basic_auth_provider"
 	basicAuthIDP.MappingMethod = "claim"
 	basicAuthIDP.BasicAuth.URL = "https://www.example.com/"
-	basicAuthIDP.BasicAuth.TLSClientCert = &oauth.TLSClientCert{Name: "my_remote_basic_auth_provider-client-cert-secret"}
-	basicAuthIDP.BasicAuth.TLSClientKey = &oauth.TLSClientKey{Name: "my_remote_basic_auth_provider-client-key-secret"}
+	basicAuthIDP.BasicAuth.TLSClientCert = &oauth.TLSClientCert{Name: "my_remote_basic_auth_provider-client-tls-secret"}
+	basicAuthIDP.BasicAuth.TLSClientKey = &oauth.TLSClientKey{Name: "my_remote_basic_auth_provider-client-tls-secret"}
 	basicAuthIDP.BasicAuth.CA = &oauth.CA{Name: "basicauth-configmap"}
 
 	expectedCrd.Spec.IdentityProviders = append(expectedCrd.Spec.IdentityProviders, basicAuthIDP)
@@ -80,9 +87,12 @@ func TestTransformMasterConfigBasicAuth(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resCrd, _, _, err := oauth.Translate(identityProviders)
+			resCrd, resSecrets, _, err := oauth.Translate(identityProviders)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expectedCrd, resCrd)
+			require.Len(t, resSecrets, 1)
+			assert.Equal(t, "my_remote_basic_auth_provider-client-tls-secret", resSecrets[0].Metadata.Name)
+			assert.Equal(t, "kubernetes.io/tls", resSecrets[0].Type)
 		})
 	}
 }
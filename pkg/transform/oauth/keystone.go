@@ -1,8 +1,6 @@
 package oauth
 
 import (
-	"encoding/base64"
-
 	"github.com/fusor/cpma/pkg/transform/configmaps"
 	"github.com/fusor/cpma/pkg/transform/secrets"
 	"github.com/sirupsen/logrus"
@@ -26,17 +24,17 @@ type Keystone struct {
 	TLSClientKey  *TLSClientKey  `yaml:"tlsClientKey,omitempty"`
 }
 
-func buildKeystoneIP(serializer *json.Serializer, p IdentityProvider) (*IdentityProviderKeystone, *secrets.Secret, *secrets.Secret, *configmaps.ConfigMap, error) {
+func buildKeystoneIP(serializer *json.Serializer, p IdentityProvider) (*IdentityProviderKeystone, *secrets.Secret, *configmaps.ConfigMap, error) {
 	var (
-		idP                   = &IdentityProviderKeystone{}
-		certSecret, keySecret *secrets.Secret
-		caConfigmap           *configmaps.ConfigMap
-		err                   error
-		keystone              configv1.KeystonePasswordIdentityProvider
+		idP         = &IdentityProviderKeystone{}
+		tlsSecret   *secrets.Secret
+		caConfigmap *configmaps.ConfigMap
+		err         error
+		keystone    configv1.KeystonePasswordIdentityProvider
 	)
 	_, _, err = serializer.Decode(p.Provider.Raw, nil, &keystone)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	idP.Type = "Keystone"
@@ -57,22 +55,15 @@ func buildKeystoneIP(serializer *json.Serializer, p IdentityProvider) (*Identity
 	}
 
 	if keystone.CertFile != "" {
-		certSecretName := p.Name + "-client-cert-secret"
-		idP.Keystone.TLSClientCert = &TLSClientCert{Name: certSecretName}
-		encoded := base64.StdEncoding.EncodeToString(p.CrtData)
-		certSecret, err = secrets.GenSecret(certSecretName, encoded, OAuthNamespace, secrets.KeystoneSecretType)
+		tlsSecretName := p.Name + "-client-tls-secret"
+		tlsSecret, err = secrets.GenTLSSecret(tlsSecretName, OAuthNamespace, p.CrtData, p.KeyData)
 		if err != nil {
-			return nil, nil, nil, nil, err
+			return nil, nil, nil, err
 		}
 
-		keySecretName := p.Name + "-client-key-secret"
-		idP.Keystone.TLSClientKey = &TLSClientKey{Name: keySecretName}
-		encoded = base64.StdEncoding.EncodeToString(p.KeyData)
-		keySecret, err = secrets.GenSecret(keySecretName, encoded, OAuthNamespace, secrets.KeystoneSecretType)
-		if err != nil {
-			return nil, nil, nil, nil, err
-		}
+		idP.Keystone.TLSClientCert = &TLSClientCert{Name: tlsSecretName}
+		idP.Keystone.TLSClientKey = &TLSClientKey{Name: tlsSecretName}
 	}
 
-	return idP, certSecret, keySecret, caConfigmap, nil
+	return idP, tlsSecret, caConfigmap, nil
 }
@@ -20,6 +20,11 @@ func TestTransformMasterConfigKeystone(t *testing.T) {
 	content, err := ioutil.ReadFile(file)
 	require.NoError(t, err)
 
+	crtContent, err := ioutil.ReadFile("../testdata/client.crt")
+	require.NoError(t, err)
+	keyContent, err := ioutil.ReadFile("../testdata/client.key")
+	require.NoError(t, err)
+
 	serializer := k8sjson.NewYAMLSerializer(k8sjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 	var masterV3 configv1.MasterConfig
 
@@ -44,6 +49,8 @@ func TestTransformMasterConfigKeystone(t *testing.T) {
 				Name:            identityProvider.Name,
 				Provider:        identityProvider.Provider,
 				HTFileName:      provider.File,
+				CrtData:         crtContent,
+				KeyData:         keyContent,
 				UseAsChallenger: identityProvider.UseAsChallenger,
 				UseAsLogin:      identityProvider.UseAsLogin,
 			})
@@ -64,8 +71,8 @@ func TestTransformMasterConfigKeystone(t *testing.T) {
 	keystoneIDP.Keystone.DomainName = "default"
 	keystoneIDP.Keystone.URL = "http://fake.url:5000"
 	keystoneIDP.Keystone.CA = &oauth.CA{Name: "keystone-configmap"}
-	keystoneIDP.Keystone.TLSClientCert = &oauth.TLSClientCert{Name: "my_keystone_provider-client-cert-secret"}
-	keystoneIDP.Keystone.TLSClientKey = &oauth.TLSClientKey{Name: "my_keystone_provider-client-key-secret"}
+	keystoneIDP.Keystone.TLSClientCert = &oauth.TLSClientCert{Name: "my_keystone_provider-client-tls-secret"}
+	keystoneIDP.Keystone.TLSClientKey = &oauth.TLSClientKey{Name: "my_keystone_provider-client-tls-secret"}
 
 	expectedCrd.Spec.IdentityProviders = append(expectedCrd.Spec.IdentityProviders, keystoneIDP)
 
@@ -81,9 +88,12 @@ func TestTransformMasterConfigKeystone(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			resCrd, _, _, err := oauth.Translate(identityProviders)
+			resCrd, resSecrets, _, err := oauth.Translate(identityProviders)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expectedCrd, resCrd)
+			require.Len(t, resSecrets, 1)
+			assert.Equal(t, "my_keystone_provider-client-tls-secret", resSecrets[0].Metadata.Name)
+			assert.Equal(t, "kubernetes.io/tls", resSecrets[0].Type)
 		})
 	}
 }
@@ -99,7 +99,7 @@ func Translate(identityProviders []IdentityProvider) (*CRD, []*secrets.Secret, [
 	oauthCrd.Metadata.NameSpace = OAuthNamespace
 	serializer := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 	for _, p := range identityProviders {
-		var secret, certSecret, keySecret *secrets.Secret
+		var secret *secrets.Secret
 		var caConfigMap *configmaps.ConfigMap
 
 		p.Provider.Object, _, err = serializer.Decode(p.Provider.Raw, nil, nil)
@@ -125,9 +125,9 @@ func Translate(identityProviders []IdentityProvider) (*CRD, []*secrets.Secret, [
 		case "LDAPPasswordIdentityProvider":
 			idP, caConfigMap, err = buildLdapIP(serializer, p)
 		case "KeystonePasswordIdentityProvider":
-			idP, certSecret, keySecret, caConfigMap, err = buildKeystoneIP(serializer, p)
+			idP, secret, caConfigMap, err = buildKeystoneIP(serializer, p)
 		case "BasicAuthPasswordIdentityProvider":
-			idP, certSecret, keySecret, caConfigMap, err = buildBasicAuthIP(serializer, p)
+			idP, secret, caConfigMap, err = buildBasicAuthIP(serializer, p)
 		default:
 			logrus.Infof("Can't handle %s OAuth kind", kind)
 			continue
@@ -135,7 +135,7 @@ func Translate(identityProviders []IdentityProvider) (*CRD, []*secrets.Secret, [
 
 		// Skip OAuth provider if error was returned
 		if err != nil {
-			logrus.Error("Can't handle ", kind, " skipping.. error:", err)
+			logrus.Errorf("Can't handle %s %s, skipping: %v", kind, p.Name, err)
 			continue
 		}
 
@@ -144,12 +144,6 @@ func Translate(identityProviders []IdentityProvider) (*CRD, []*secrets.Secret, [
 			secretsSlice = append(secretsSlice, secret)
 		}
 
-		// Check if certSecret is not empty
-		if certSecret != nil {
-			secretsSlice = append(secretsSlice, certSecret)
-			secretsSlice = append(secretsSlice, keySecret)
-		}
-
 		// Check if config map is not empty
 		if caConfigMap != nil {
 			сonfigMapSlice = append(сonfigMapSlice, caConfigMap)
@@ -165,7 +159,7 @@ func Translate(identityProviders []IdentityProvider) (*CRD, []*secrets.Secret, [
 func (oauth *CRD) GenYAML() ([]byte, error) {
 	yamlBytes, err := yaml.Marshal(&oauth)
 	if err != nil {
-		logrus.Debugf("Error in OAuth CRD, OAuth CRD - %+v", yamlBytes)
+		logrus.Debugf("Error in OAuth CRD %s: %v", oauth.Metadata.Name, err)
 		return nil, err
 	}
 
@@ -20,6 +20,11 @@ func TestTransformMasterConfig(t *testing.T) {
 	content, err := ioutil.ReadFile(file)
 	require.NoError(t, err)
 
+	crtContent, err := ioutil.ReadFile("../testdata/client.crt")
+	require.NoError(t, err)
+	keyContent, err := ioutil.ReadFile("../testdata/client.key")
+	require.NoError(t, err)
+
 	serializer := k8sjson.NewYAMLSerializer(k8sjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 	var masterV3 configv1.MasterConfig
 
@@ -44,6 +49,8 @@ func TestTransformMasterConfig(t *testing.T) {
 				Name:            identityProvider.Name,
 				Provider:        identityProvider.Provider,
 				HTFileName:      provider.File,
+				CrtData:         crtContent,
+				KeyData:         keyContent,
 				UseAsChallenger: identityProvider.UseAsChallenger,
 				UseAsLogin:      identityProvider.UseAsLogin,
 			})
@@ -88,7 +95,7 @@ func TestGenYAML(t *testing.T) {
 			name:                    "generate yaml for oauth providers",
 			inputConfigfile:         "testdata/bulk-test-master-config.yaml",
 			expectedYaml:            "testdata/expected-bulk-test-masterconfig-oauth.yaml",
-			expectedSecretsLength:   9,
+			expectedSecretsLength:   7,
 			expectedConfigMapsength: 6,
 		},
 		{
@@ -108,6 +115,11 @@ func TestGenYAML(t *testing.T) {
 			content, err := ioutil.ReadFile(tc.inputConfigfile)
 			require.NoError(t, err)
 
+			crtContent, err := ioutil.ReadFile("../testdata/client.crt")
+			require.NoError(t, err)
+			keyContent, err := ioutil.ReadFile("../testdata/client.key")
+			require.NoError(t, err)
+
 			serializer := k8sjson.NewYAMLSerializer(k8sjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 			var masterV3 configv1.MasterConfig
 
@@ -131,6 +143,8 @@ func TestGenYAML(t *testing.T) {
 						Name:            identityProvider.Name,
 						Provider:        identityProvider.Provider,
 						HTFileName:      provider.File,
+						CrtData:         crtContent,
+						KeyData:         keyContent,
 						UseAsChallenger: identityProvider.UseAsChallenger,
 						UseAsLogin:      identityProvider.UseAsLogin,
 					})
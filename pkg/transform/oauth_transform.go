@@ -5,15 +5,16 @@ import (
 	"errors"
 
 	"github.com/fusor/cpma/pkg/config"
-	"github.com/fusor/cpma/pkg/config/decode"
-	"github.com/fusor/cpma/pkg/env"
 	"github.com/fusor/cpma/pkg/transform/oauth"
+	"github.com/fusor/cpma/pkg/transform/secrets"
 	"github.com/sirupsen/logrus"
 )
 
 // OAuthExtraction holds OAuth data extracted from OCP3
 type OAuthExtraction struct {
 	IdentityProviders []oauth.IdentityProvider
+	// SecretsStrategy generates the manifests of secrets, raw Secrets if nil
+	SecretsStrategy secrets.Strategy
 }
 
 // OAuthTransform is an OAuth specific transform
@@ -29,7 +30,7 @@ func (e OAuthExtraction) Transform() (Output, error) {
 
 	oauth, secrets, configMaps, err := oauth.Translate(e.IdentityProviders)
 	if err != nil {
-		return nil, errors.New("Unable to generate OAuth CRD")
+		return nil, errors.New("Unable to generate OAuth CRD: " + err.Error())
 	}
 
 	ocp4Cluster.Master.OAuth = *oauth
@@ -47,7 +48,7 @@ func (e OAuthExtraction) Transform() (Output, error) {
 		manifests = append(manifests, manifest)
 
 		for _, secret := range ocp4Cluster.Master.Secrets {
-			secretCR, err := secret.GenYAML()
+			secretCR, err := e.genSecretYAML(secret)
 			if err != nil {
 				return nil, err
 			}
@@ -72,24 +73,32 @@ func (e OAuthExtraction) Transform() (Output, error) {
 	return ManifestOutput{Manifests: manifests}, nil
 }
 
+// genSecretYAML returns the manifest of secret with the secrets strategy
+func (e OAuthExtraction) genSecretYAML(secret *secrets.Secret) ([]byte, error) {
+	if e.SecretsStrategy == nil {
+		return secret.GenYAML()
+	}
+
+	return e.SecretsStrategy.GenYAML(secret)
+}
+
 // Extract collects OAuth configuration from an OCP3 cluster
 func (e OAuthTransform) Extract() (Extraction, error) {
 	logrus.Info("OAuthTransform::Extract")
-	content, err := e.Config.Fetch(env.Config().GetString("MasterConfigFile"))
+	masterConfig, err := e.Config.MasterConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	masterConfig, err := decode.MasterConfig(content)
+	secretsStrategy, err := secrets.NewStrategy(e.Config.Secrets)
 	if err != nil {
 		return nil, err
 	}
-
-	var extraction OAuthExtraction
-	var htContent, caContent, crtContent, keyContent []byte
+	extraction := OAuthExtraction{SecretsStrategy: secretsStrategy}
 
 	if masterConfig.OAuthConfig != nil {
 		for _, identityProvider := range masterConfig.OAuthConfig.IdentityProviders {
+			var htContent, caContent, crtContent, keyContent []byte
 
 			providerJSON, err := identityProvider.Provider.MarshalJSON()
 			if err != nil {
@@ -103,7 +112,7 @@ func (e OAuthTransform) Extract() (Extraction, error) {
 			}
 
 			if provider.File != "" {
-				htContent, err = e.Config.Fetch(provider.File)
+				htContent, err = e.Config.FetchSensitive(provider.File)
 				if err != nil {
 					return nil, err
 				}
@@ -121,7 +130,7 @@ func (e OAuthTransform) Extract() (Extraction, error) {
 				}
 			}
 			if provider.KeyFile != "" {
-				keyContent, err = e.Config.Fetch(provider.KeyFile)
+				keyContent, err = e.Config.FetchSensitive(provider.KeyFile)
 				if err != nil {
 					return nil, err
 				}
@@ -158,3 +167,8 @@ func (e OAuthExtraction) Validate() error {
 func (e OAuthTransform) Name() string {
 	return "OAuth"
 }
+
+// Description tells what the transform migrates
+func (e OAuthTransform) Description() string {
+	return "Migrates the identity providers, with their secrets and CA config maps"
+}
@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/io"
 	"github.com/fusor/cpma/pkg/transform/configmaps"
 
 	"github.com/fusor/cpma/pkg/transform/oauth"
@@ -31,6 +33,8 @@ func loadTestIdentityProviders() []oauth.IdentityProvider {
 	serializer := k8sjson.NewYAMLSerializer(k8sjson.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
 	var masterV3 configv1.MasterConfig
 	_, _, _ = serializer.Decode(content, nil, &masterV3)
+	crtContent, _ := ioutil.ReadFile("testdata/client.crt")
+	keyContent, _ := ioutil.ReadFile("testdata/client.key")
 
 	var identityProviders []oauth.IdentityProvider
 	for _, identityProvider := range masterV3.OAuthConfig.IdentityProviders {
@@ -47,8 +51,8 @@ func loadTestIdentityProviders() []oauth.IdentityProvider {
 				Provider:        identityProvider.Provider,
 				HTFileName:      provider.File,
 				HTFileData:      nil,
-				CrtData:         nil,
-				KeyData:         nil,
+				CrtData:         crtContent,
+				KeyData:         keyContent,
 				UseAsChallenger: identityProvider.UseAsChallenger,
 				UseAsLogin:      identityProvider.UseAsLogin,
 			})
@@ -59,6 +63,11 @@ func loadTestIdentityProviders() []oauth.IdentityProvider {
 func TestOAuthExtractionTransform(t *testing.T) {
 	var expectedManifests []Manifest
 
+	crtContent, err := ioutil.ReadFile("testdata/client.crt")
+	require.NoError(t, err)
+	keyContent, err := ioutil.ReadFile("testdata/client.key")
+	require.NoError(t, err)
+
 	var expectedCrd oauth.CRD
 	expectedCrd.APIVersion = "config.openshift.io/v1"
 	expectedCrd.Kind = "OAuth"
@@ -72,25 +81,20 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	basicAuthIDP.Name = "my_remote_basic_auth_provider"
 	basicAuthIDP.MappingMethod = "claim"
 	basicAuthIDP.BasicAuth.URL = "https://www.example.com/"
-	basicAuthIDP.BasicAuth.TLSClientCert = &oauth.TLSClientCert{Name: "my_remote_basic_auth_provider-client-cert-secret"}
-	basicAuthIDP.BasicAuth.TLSClientKey = &oauth.TLSClientKey{Name: "my_remote_basic_auth_provider-client-key-secret"}
+	basicAuthIDP.BasicAuth.TLSClientCert = &oauth.TLSClientCert{Name: "my_remote_basic_auth_provider-client-tls-secret"}
+	basicAuthIDP.BasicAuth.TLSClientKey = &oauth.TLSClientKey{Name: "my_remote_basic_auth_provider-client-tls-secret"}
 	basicAuthIDP.BasicAuth.CA = &oauth.CA{Name: "basicauth-configmap"}
 
-	var basicAuthCrtSecretCrd secrets.Secret
-	basicAuthCrtSecretCrd.APIVersion = "v1"
-	basicAuthCrtSecretCrd.Kind = "Secret"
-	basicAuthCrtSecretCrd.Type = "Opaque"
-	basicAuthCrtSecretCrd.Metadata.Namespace = oauth.OAuthNamespace
-	basicAuthCrtSecretCrd.Metadata.Name = "my_remote_basic_auth_provider-client-cert-secret"
-	basicAuthCrtSecretCrd.Data = secrets.BasicAuthFileSecret{BasicAuth: base64.StdEncoding.EncodeToString([]byte(""))}
-
-	var basicAuthKeySecretCrd secrets.Secret
-	basicAuthKeySecretCrd.APIVersion = "v1"
-	basicAuthKeySecretCrd.Kind = "Secret"
-	basicAuthKeySecretCrd.Type = "Opaque"
-	basicAuthKeySecretCrd.Metadata.Namespace = oauth.OAuthNamespace
-	basicAuthKeySecretCrd.Metadata.Name = "my_remote_basic_auth_provider-client-key-secret"
-	basicAuthKeySecretCrd.Data = secrets.BasicAuthFileSecret{BasicAuth: base64.StdEncoding.EncodeToString([]byte(""))}
+	var basicAuthTLSSecretCrd secrets.Secret
+	basicAuthTLSSecretCrd.APIVersion = "v1"
+	basicAuthTLSSecretCrd.Kind = "Secret"
+	basicAuthTLSSecretCrd.Type = "kubernetes.io/tls"
+	basicAuthTLSSecretCrd.Metadata.Namespace = oauth.OAuthNamespace
+	basicAuthTLSSecretCrd.Metadata.Name = "my_remote_basic_auth_provider-client-tls-secret"
+	basicAuthTLSSecretCrd.Data = secrets.TLSSecret{
+		Cert: base64.StdEncoding.EncodeToString(crtContent),
+		Key:  base64.StdEncoding.EncodeToString(keyContent),
+	}
 
 	var basicAuthConfigMap configmaps.ConfigMap
 	basicAuthConfigMap.APIVersion = "v1"
@@ -180,8 +184,8 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	keystoneIDP.Keystone.DomainName = "default"
 	keystoneIDP.Keystone.URL = "http://fake.url:5000"
 	keystoneIDP.Keystone.CA = &oauth.CA{Name: "keystone-configmap"}
-	keystoneIDP.Keystone.TLSClientCert = &oauth.TLSClientCert{Name: "my_keystone_provider-client-cert-secret"}
-	keystoneIDP.Keystone.TLSClientKey = &oauth.TLSClientKey{Name: "my_keystone_provider-client-key-secret"}
+	keystoneIDP.Keystone.TLSClientCert = &oauth.TLSClientCert{Name: "my_keystone_provider-client-tls-secret"}
+	keystoneIDP.Keystone.TLSClientKey = &oauth.TLSClientKey{Name: "my_keystone_provider-client-tls-secret"}
 
 	var keystoneConfigMap configmaps.ConfigMap
 	keystoneConfigMap.APIVersion = "v1"
@@ -206,21 +210,16 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	htpasswdSecretCrd.Metadata.Name = "htpasswd_auth-secret"
 	htpasswdSecretCrd.Data = secrets.HTPasswdFileSecret{HTPasswd: ""}
 
-	var keystoneCrtSecretCrd secrets.Secret
-	keystoneCrtSecretCrd.APIVersion = "v1"
-	keystoneCrtSecretCrd.Kind = "Secret"
-	keystoneCrtSecretCrd.Type = "Opaque"
-	keystoneCrtSecretCrd.Metadata.Namespace = oauth.OAuthNamespace
-	keystoneCrtSecretCrd.Metadata.Name = "my_keystone_provider-client-cert-secret"
-	keystoneCrtSecretCrd.Data = secrets.KeystoneFileSecret{Keystone: ""}
-
-	var keystoneKeySecretCrd secrets.Secret
-	keystoneKeySecretCrd.APIVersion = "v1"
-	keystoneKeySecretCrd.Kind = "Secret"
-	keystoneKeySecretCrd.Type = "Opaque"
-	keystoneKeySecretCrd.Metadata.Namespace = oauth.OAuthNamespace
-	keystoneKeySecretCrd.Metadata.Name = "my_keystone_provider-client-key-secret"
-	keystoneKeySecretCrd.Data = secrets.KeystoneFileSecret{Keystone: ""}
+	var keystoneTLSSecretCrd secrets.Secret
+	keystoneTLSSecretCrd.APIVersion = "v1"
+	keystoneTLSSecretCrd.Kind = "Secret"
+	keystoneTLSSecretCrd.Type = "kubernetes.io/tls"
+	keystoneTLSSecretCrd.Metadata.Namespace = oauth.OAuthNamespace
+	keystoneTLSSecretCrd.Metadata.Name = "my_keystone_provider-client-tls-secret"
+	keystoneTLSSecretCrd.Data = secrets.TLSSecret{
+		Cert: base64.StdEncoding.EncodeToString(crtContent),
+		Key:  base64.StdEncoding.EncodeToString(keyContent),
+	}
 
 	var ldapIDP oauth.IdentityProviderLDAP
 	ldapIDP.Name = "my_ldap_provider"
@@ -301,9 +300,7 @@ func TestOAuthExtractionTransform(t *testing.T) {
 
 	expectedManifest, err := expectedCrd.GenYAML()
 	require.NoError(t, err)
-	basicAuthCrtSecretManifest, err := basicAuthCrtSecretCrd.GenYAML()
-	require.NoError(t, err)
-	basicAuthKeySecretManifest, err := basicAuthKeySecretCrd.GenYAML()
+	basicAuthTLSSecretManifest, err := basicAuthTLSSecretCrd.GenYAML()
 	require.NoError(t, err)
 	githubSecretManifest, err := githubSecretCrd.GenYAML()
 	require.NoError(t, err)
@@ -313,9 +310,7 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	require.NoError(t, err)
 	htpasswdSecretManifest, err := htpasswdSecretCrd.GenYAML()
 	require.NoError(t, err)
-	keystoneCrtSecretManifest, err := keystoneCrtSecretCrd.GenYAML()
-	require.NoError(t, err)
-	keystoneKeySecretManifest, err := keystoneKeySecretCrd.GenYAML()
+	keystoneTLSSecretManifest, err := keystoneTLSSecretCrd.GenYAML()
 	require.NoError(t, err)
 	openidSecretManifest, err := openidSecretCrd.GenYAML()
 	require.NoError(t, err)
@@ -336,9 +331,7 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	expectedManifests = append(expectedManifests,
 		Manifest{Name: "100_CPMA-cluster-config-oauth.yaml", CRD: expectedManifest})
 	expectedManifests = append(expectedManifests,
-		Manifest{Name: "100_CPMA-cluster-config-secret-my_remote_basic_auth_provider-client-cert-secret.yaml", CRD: basicAuthCrtSecretManifest})
-	expectedManifests = append(expectedManifests,
-		Manifest{Name: "100_CPMA-cluster-config-secret-my_remote_basic_auth_provider-client-key-secret.yaml", CRD: basicAuthKeySecretManifest})
+		Manifest{Name: "100_CPMA-cluster-config-secret-my_remote_basic_auth_provider-client-tls-secret.yaml", CRD: basicAuthTLSSecretManifest})
 	expectedManifests = append(expectedManifests,
 		Manifest{Name: "100_CPMA-cluster-config-secret-github123456789-secret.yaml", CRD: githubSecretManifest})
 	expectedManifests = append(expectedManifests,
@@ -348,9 +341,7 @@ func TestOAuthExtractionTransform(t *testing.T) {
 	expectedManifests = append(expectedManifests,
 		Manifest{Name: "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml", CRD: htpasswdSecretManifest})
 	expectedManifests = append(expectedManifests,
-		Manifest{Name: "100_CPMA-cluster-config-secret-my_keystone_provider-client-cert-secret.yaml", CRD: keystoneCrtSecretManifest})
-	expectedManifests = append(expectedManifests,
-		Manifest{Name: "100_CPMA-cluster-config-secret-my_keystone_provider-client-key-secret.yaml", CRD: keystoneKeySecretManifest})
+		Manifest{Name: "100_CPMA-cluster-config-secret-my_keystone_provider-client-tls-secret.yaml", CRD: keystoneTLSSecretManifest})
 	expectedManifests = append(expectedManifests,
 		Manifest{Name: "100_CPMA-cluster-config-secret-my_openid_connect-secret.yaml", CRD: openidSecretManifest})
 	expectedManifests = append(expectedManifests,
@@ -380,11 +371,10 @@ func TestOAuthExtractionTransform(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			actualManifestsChan := make(chan []Manifest)
 
-			// Override flush method
-			manifestOutputFlush = func(manifests []Manifest) error {
+			writer := writerFunc(func(manifests []Manifest) error {
 				actualManifestsChan <- manifests
 				return nil
-			}
+			})
 
 			testExtraction := OAuthExtraction{
 				IdentityProviders: loadTestIdentityProviders(),
@@ -395,7 +385,7 @@ func TestOAuthExtractionTransform(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				transformOutput.Flush()
+				transformOutput.Flush(writer)
 			}()
 
 			actualManifests := <-actualManifestsChan
@@ -403,3 +393,64 @@ func TestOAuthExtractionTransform(t *testing.T) {
 		})
 	}
 }
+
+func TestOAuthExtractTLSPerProvider(t *testing.T) {
+	masterConfig := `oauthConfig:
+  identityProviders:
+  - name: my_keystone_provider
+    challenge: true
+    login: true
+    mappingMethod: claim
+    provider:
+      apiVersion: v1
+      kind: KeystonePasswordIdentityProvider
+      domainName: default
+      url: http://fake.url:5000
+      certFile: /etc/origin/master/keystone.crt
+      keyFile: /etc/origin/master/keystone.key
+  - name: my_remote_basic_auth_provider
+    challenge: true
+    login: true
+    mappingMethod: claim
+    provider:
+      apiVersion: v1
+      kind: BasicAuthPasswordIdentityProvider
+      url: https://www.example.com/
+`
+	files := map[string]string{
+		"/etc/origin/master/master-config.yaml": masterConfig,
+		"/etc/origin/master/keystone.crt":       "testdata/client.crt",
+		"/etc/origin/master/keystone.key":       "testdata/client.key",
+	}
+
+	getFile := io.GetFile
+	getSensitiveFile := io.GetSensitiveFile
+	defer func() {
+		io.GetFile = getFile
+		io.GetSensitiveFile = getSensitiveFile
+	}()
+	io.GetFile = func(host, src, cacheDir string, mode io.CacheMode) ([]byte, error) {
+		if src == "/etc/origin/master/master-config.yaml" {
+			return []byte(files[src]), nil
+		}
+		return ioutil.ReadFile(files[src])
+	}
+	io.GetSensitiveFile = func(host, src, cacheDir string, mode io.CacheMode, keyFiles []string) ([]byte, error) {
+		return ioutil.ReadFile(files[src])
+	}
+
+	cfg := &config.Config{
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		Cache:            config.NewCache(),
+	}
+	extraction, err := OAuthTransform{Config: cfg}.Extract()
+	require.NoError(t, err)
+
+	identityProviders := extraction.(OAuthExtraction).IdentityProviders
+	require.Len(t, identityProviders, 2)
+	assert.NotEmpty(t, identityProviders[0].CrtData)
+	assert.NotEmpty(t, identityProviders[0].KeyData)
+	assert.Empty(t, identityProviders[1].CrtData)
+	assert.Empty(t, identityProviders[1].KeyData)
+}
@@ -0,0 +1,151 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/sirupsen/logrus"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// PatchScript is the script applying the patches, written with them
+const PatchScript = "apply-patches.sh"
+
+// createdKinds are created on the cluster as they are, cpma naming them, while
+// every other object exists already on an installed cluster and is patched
+var createdKinds = map[string]bool{
+	"ConfigMap":      true,
+	"Secret":         true,
+	"SealedSecret":   true,
+	"ExternalSecret": true,
+}
+
+// defaultObjectName is the name of the cluster wide configuration objects
+const defaultObjectName = "cluster"
+
+// patchWriter writes manifests as JSON merge patches of the objects of an
+// installed cluster into OutputDir/patches, along with a script running
+// `oc patch` for each. Only the fields cpma migrates are set, lists being
+// replaced as a whole. Secrets and ConfigMaps are written as complete objects,
+// which the script creates first with `oc apply`.
+type patchWriter struct {
+	dir       string
+	encrypter *encrypt.Encrypter
+	// commands holds the command of the patch script for each manifest
+	commands map[string]string
+}
+
+func newPatchWriter(options WriterOptions) (Writer, error) {
+	return &patchWriter{
+		dir:       filepath.Join(options.OutputDir, "patches"),
+		encrypter: options.Encrypter,
+		commands:  make(map[string]string),
+	}, nil
+}
+
+func (w *patchWriter) Write(manifests []Manifest) error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		file := strings.TrimSuffix(manifest.Name, filepath.Ext(manifest.Name)) + ".json"
+		content, command, err := patch(manifest, file)
+		if err != nil {
+			return errors.New(manifest.Name + ": " + err.Error())
+		}
+
+		if isSecret(manifest) {
+			if err := encrypt.WriteFile(filepath.Join(w.dir, file), content, w.encrypter); err != nil {
+				return err
+			}
+		} else if err := ioutil.WriteFile(filepath.Join(w.dir, file), content, 0644); err != nil {
+			return err
+		}
+		logrus.Printf("Patch:Added: %s", filepath.Join(w.dir, file))
+		w.commands[manifest.Name] = command
+	}
+
+	return nil
+}
+
+// Close writes the patch script
+func (w *patchWriter) Close() error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(w.dir, PatchScript), patchScript(w.commands), 0755)
+}
+
+// patch returns the content written for manifest into file, and the command
+// applying it
+func patch(manifest Manifest, file string) ([]byte, string, error) {
+	content, err := k8syaml.ToJSON(manifest.CRD)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(content, &object); err != nil {
+		return nil, "", err
+	}
+
+	kind, _ := object["kind"].(string)
+	apiVersion, _ := object["apiVersion"].(string)
+	if kind == "" || apiVersion == "" {
+		return nil, "", errors.New("missing apiVersion or kind")
+	}
+
+	if createdKinds[kind] {
+		content, err = json.MarshalIndent(object, "", "  ")
+		return content, "oc apply -f " + sftpclient.ShellQuote(file), err
+	}
+
+	name := defaultObjectName
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadataName, ok := metadata["name"].(string); ok && metadataName != "" {
+		name = metadataName
+	}
+
+	resource := strings.ToLower(kind)
+	if i := strings.Index(apiVersion, "/"); i != -1 {
+		resource += "." + apiVersion[:i]
+	}
+
+	delete(object, "apiVersion")
+	delete(object, "kind")
+	delete(object, "metadata")
+	content, err = json.MarshalIndent(object, "", "  ")
+
+	return content, "oc patch " + sftpclient.ShellQuote(resource) + " " + sftpclient.ShellQuote(name) + ` --type merge --patch "$(cat ` + sftpclient.ShellQuote(file) + `)"`, err
+}
+
+// patchScript runs the commands, creating objects before patching the ones
+// referring to them
+func patchScript(commands map[string]string) []byte {
+	var created, patched []string
+	for _, command := range commands {
+		if strings.HasPrefix(command, "oc apply") {
+			created = append(created, command)
+		} else {
+			patched = append(patched, command)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(patched)
+
+	script := "#!/bin/sh\n# Generated by cpma, applies the migrated configuration to an installed cluster\nset -e\ncd \"$(dirname \"$0\")\"\n\n"
+	for _, command := range append(created, patched...) {
+		script += command + "\n"
+	}
+
+	return []byte(script)
+}
@@ -0,0 +1,132 @@
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchWriter(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-patches")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	writer, err := NewWriter("patch", WriterOptions{OutputDir: outputDir})
+	require.NoError(t, err)
+
+	oauth := `apiVersion: config.openshift.io/v1
+kind: OAuth
+metadata:
+  name: cluster
+  namespace: openshift-config
+spec:
+  identityProviders:
+  - name: htpasswd_auth
+    type: HTPasswd
+    htpasswd:
+      fileData:
+        name: htpasswd_auth-secret
+`
+	secret := `apiVersion: v1
+kind: Secret
+type: Opaque
+metadata:
+  name: htpasswd_auth-secret
+  namespace: openshift-config
+data:
+  htpasswd: dXNlcjpwYXNzd29yZA==
+`
+	network := `apiVersion: operator.openshift.io/v1
+kind: Network
+spec:
+  serviceNetwork: 172.30.0.0/16
+`
+
+	require.NoError(t, writer.Write([]Manifest{
+		{Name: "100_CPMA-cluster-config-oauth.yaml", CRD: []byte(oauth)},
+		{Name: "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml", CRD: []byte(secret)},
+	}))
+	require.NoError(t, writer.Write([]Manifest{
+		{Name: "100_CPMA-cluster-config-sdn.yaml", CRD: []byte(network)},
+	}))
+	require.NoError(t, writer.Close())
+
+	dir := filepath.Join(outputDir, "patches")
+	content, err := ioutil.ReadFile(filepath.Join(dir, "100_CPMA-cluster-config-oauth.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spec": {"identityProviders": [{"name": "htpasswd_auth", "type": "HTPasswd", "htpasswd": {"fileData": {"name": "htpasswd_auth-secret"}}}]}}`, string(content))
+
+	content, err = ioutil.ReadFile(filepath.Join(dir, "100_CPMA-cluster-config-secret-htpasswd_auth-secret.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion": "v1", "kind": "Secret", "type": "Opaque",
+		"metadata": {"name": "htpasswd_auth-secret", "namespace": "openshift-config"},
+		"data": {"htpasswd": "dXNlcjpwYXNzd29yZA=="}}`, string(content))
+
+	script, err := ioutil.ReadFile(filepath.Join(dir, PatchScript))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), `oc apply -f '100_CPMA-cluster-config-secret-htpasswd_auth-secret.json'
+oc patch 'network.operator.openshift.io' 'cluster' --type merge --patch "$(cat '100_CPMA-cluster-config-sdn.json')"
+oc patch 'oauth.config.openshift.io' 'cluster' --type merge --patch "$(cat '100_CPMA-cluster-config-oauth.json')"
+`)
+
+	info, err := os.Stat(filepath.Join(dir, PatchScript))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100, "script is executable")
+}
+
+func TestPatchWriterInvalidManifest(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-patches")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	writer, err := NewWriter("patch", WriterOptions{OutputDir: outputDir})
+	require.NoError(t, err)
+
+	err = writer.Write([]Manifest{{Name: "100_CPMA-invalid.yaml", CRD: []byte("spec: {}\n")}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "100_CPMA-invalid.yaml: missing apiVersion or kind")
+}
+
+func TestPatchWriterQuotesNames(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-patches")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	writer, err := NewWriter("patch", WriterOptions{OutputDir: outputDir})
+	require.NoError(t, err)
+
+	// A provider named it's$(touch pwned)
+	secret := `apiVersion: v1
+kind: Secret
+type: Opaque
+metadata:
+  name: it's$(touch pwned)-secret
+  namespace: openshift-config
+`
+	require.NoError(t, writer.Write([]Manifest{
+		{Name: "100_CPMA-cluster-config-secret-it's$(touch pwned)-secret.yaml", CRD: []byte(secret)},
+	}))
+	require.NoError(t, writer.Close())
+
+	dir := filepath.Join(outputDir, "patches")
+	script, err := ioutil.ReadFile(filepath.Join(dir, PatchScript))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), `oc apply -f '100_CPMA-cluster-config-secret-it'\''s$(touch pwned)-secret.json'`)
+
+	// Run the script with an oc printing its arguments
+	bin := filepath.Join(outputDir, "bin")
+	require.NoError(t, os.Mkdir(bin, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bin, "oc"), []byte("#!/bin/sh\nprintf '%s\\n' \"$@\"\n"), 0755))
+	cmd := exec.Command("sh", filepath.Join(dir, PatchScript))
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "apply\n-f\n100_CPMA-cluster-config-secret-it's$(touch pwned)-secret.json\n", string(out))
+	_, err = os.Stat(filepath.Join(dir, "pwned"))
+	assert.True(t, os.IsNotExist(err))
+}
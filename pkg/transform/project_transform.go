@@ -0,0 +1,133 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// FactDefaultNodeSelector is the fact holding the node selector of projects
+// without one, set as the Scheduler default by the scheduler transform
+const FactDefaultNodeSelector = "defaultNodeSelector"
+
+// ProjectExtraction holds the project configuration extracted from OCP3
+type ProjectExtraction struct {
+	ProjectRequestMessage string
+	// ProjectRequestTemplate is the template of new projects, as
+	// <namespace>/<name>
+	ProjectRequestTemplate string
+}
+
+// ProjectCR is a Project Cluster Resource
+type ProjectCR struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   Metadata    `yaml:"metadata"`
+	Spec       ProjectSpec `yaml:"spec"`
+}
+
+// ProjectSpec is a Spec for a ProjectCR
+type ProjectSpec struct {
+	ProjectRequestMessage  string                  `yaml:"projectRequestMessage,omitempty"`
+	ProjectRequestTemplate *ProjectRequestTemplate `yaml:"projectRequestTemplate,omitempty"`
+}
+
+// ProjectRequestTemplate is the template of new projects, in the
+// openshift-config namespace
+type ProjectRequestTemplate struct {
+	Name string `yaml:"name"`
+}
+
+// ProjectTransform is a project configuration specific transform. It stores
+// the default node selector of projects for the scheduler transform.
+type ProjectTransform struct {
+	Config *config.Config
+	Facts  *Facts
+}
+
+// Transform converts the project configuration collected from an OCP3
+// cluster to an OCP4 CR
+func (e ProjectExtraction) Transform() (Output, error) {
+	logrus.Info("ProjectTransform::Transform")
+
+	const (
+		apiVersion = "config.openshift.io/v1"
+		kind       = "Project"
+		name       = "cluster"
+		annokey    = "release.openshift.io/create-only"
+		annoval    = "true"
+	)
+
+	var projectCR ProjectCR
+	projectCR.APIVersion = apiVersion
+	projectCR.Kind = kind
+	projectCR.Metadata.Name = name
+	projectCR.Metadata.Annotations = map[string]string{annokey: annoval}
+	projectCR.Spec.ProjectRequestMessage = e.ProjectRequestMessage
+	var output ManifestOutput
+	if e.ProjectRequestTemplate != "" {
+		template := e.ProjectRequestTemplate[strings.LastIndex(e.ProjectRequestTemplate, "/")+1:]
+		projectCR.Spec.ProjectRequestTemplate = &ProjectRequestTemplate{Name: template}
+		output.Findings = append(output.Findings, "Project request template "+e.ProjectRequestTemplate+" is not migrated, create it as "+template+" in the openshift-config namespace")
+	}
+
+	projectCRYAML, err := yaml.Marshal(&projectCR)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Manifests = append(output.Manifests, Manifest{Name: "100_CPMA-cluster-config-project.yaml", CRD: projectCRYAML})
+
+	return output, nil
+}
+
+// Extract collects the project configuration of an OCP3 master and stores
+// the default node selector as FactDefaultNodeSelector
+func (e ProjectTransform) Extract() (Extraction, error) {
+	logrus.Info("ProjectTransform::Extract")
+	masterConfig, err := e.Config.MasterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	projectConfig := masterConfig.ProjectConfig
+	if e.Facts != nil {
+		e.Facts.Set(FactDefaultNodeSelector, projectConfig.DefaultNodeSelector)
+	}
+
+	return ProjectExtraction{
+		ProjectRequestMessage:  projectConfig.ProjectRequestMessage,
+		ProjectRequestTemplate: projectConfig.ProjectRequestTemplate,
+	}, nil
+}
+
+// Validate the project configuration collected from an OCP3 cluster
+func (e ProjectExtraction) Validate() error {
+	if e.ProjectRequestMessage == "" && e.ProjectRequestTemplate == "" {
+		return NothingToMigrate{Reason: "no project request message nor template configured, not generating a cr"}
+	}
+	return nil
+}
+
+// Name returns a human readable name for the transform
+func (e ProjectTransform) Name() string {
+	return "Project"
+}
+
+// Description tells what the transform migrates
+func (e ProjectTransform) Description() string {
+	return "Migrates the project request message and template, and shares the default node selector with Scheduler"
+}
+
+// Produces returns the facts the transform stores
+func (e ProjectTransform) Produces() []string {
+	return []string{FactDefaultNodeSelector}
+}
+
+// WithFacts returns the transform storing its facts in facts
+func (e ProjectTransform) WithFacts(facts *Facts) Transform {
+	e.Facts = facts
+	return e
+}
@@ -1,11 +1,8 @@
 package transform
 
 import (
-	"errors"
-
-	"github.com/BurntSushi/toml"
 	"github.com/fusor/cpma/pkg/config"
-	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/config/decode"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
@@ -13,12 +10,13 @@ import (
 // RegistriesExtraction holds registry information extracted from an OCP3 cluster
 type RegistriesExtraction struct {
 	Registries map[string]Registries
+	// ImagePolicy is merged into the Image CR, nil if unknown
+	ImagePolicy *ImagePolicy `toml:"-"`
+	Target      *config.Target
 }
 
 // Registries holds a list of Registries
-type Registries struct {
-	List []string `toml:"registries"`
-}
+type Registries = decode.RegistryList
 
 // ImageCR is an Image Cluster Resource
 type ImageCR struct {
@@ -36,11 +34,14 @@ type Metadata struct {
 
 // ImageSpec is a Spec for an ImageCR
 type ImageSpec struct {
-	RegistrySources RegistrySources `yaml:"registrySources"`
+	AllowedRegistriesForImport []RegistryLocation `yaml:"allowedRegistriesForImport,omitempty"`
+	ExternalRegistryHostnames  []string           `yaml:"externalRegistryHostnames,omitempty"`
+	RegistrySources            RegistrySources    `yaml:"registrySources"`
 }
 
-// RegistrySources holds lists of blocked and insecure registries from an OCP3 cluster
+// RegistrySources holds lists of allowed, blocked and insecure registries from an OCP3 cluster
 type RegistrySources struct {
+	AllowedRegistries  []string `yaml:"allowedRegistries,omitempty"`
 	BlockedRegistries  []string `yaml:"blockedRegistries,omitempty"`
 	InsecureRegistries []string `yaml:"insecureRegistries,omitempty"`
 }
@@ -48,12 +49,14 @@ type RegistrySources struct {
 // RegistriesTransform is a registry specific transform
 type RegistriesTransform struct {
 	Config *config.Config
+	Facts  *Facts
 }
 
 // Transform contains registry configuration collected from an OCP3 cluster
 func (e RegistriesExtraction) Transform() (Output, error) {
 	logrus.Info("RegistriesTransform::Extraction")
 	var manifests []Manifest
+	var findings []string
 
 	const (
 		apiVersion = "config.openshift.io/v1"
@@ -61,6 +64,8 @@ func (e RegistriesExtraction) Transform() (Output, error) {
 		name       = "cluster"
 		annokey    = "release.openshift.io/create-only"
 		annoval    = "true"
+		// blockAll blocks every registry but the search and insecure ones
+		blockAll = "all"
 	)
 
 	var imageCR ImageCR
@@ -71,6 +76,28 @@ func (e RegistriesExtraction) Transform() (Output, error) {
 	imageCR.Metadata.Annotations[annokey] = annoval
 	imageCR.Spec.RegistrySources.BlockedRegistries = e.Registries["block"].List
 	imageCR.Spec.RegistrySources.InsecureRegistries = e.Registries["insecure"].List
+	if e.ImagePolicy != nil {
+		imageCR.Spec.AllowedRegistriesForImport = e.ImagePolicy.AllowedRegistriesForImport
+		if e.ImagePolicy.ExternalRegistryHostname != "" {
+			imageCR.Spec.ExternalRegistryHostnames = []string{e.ImagePolicy.ExternalRegistryHostname}
+		}
+	}
+
+	for _, blocked := range e.Registries["block"].List {
+		if blocked != blockAll {
+			continue
+		}
+
+		imageCR.Spec.RegistrySources.BlockedRegistries = nil
+		if e.Target.Supports(config.ImageAllowedRegistries) {
+			allowed := append([]string{}, e.Registries["search"].List...)
+			allowed = append(allowed, e.Registries["insecure"].List...)
+			imageCR.Spec.RegistrySources.AllowedRegistries = allowed
+		} else {
+			findings = append(findings, notGenerated(e.Target, config.ImageAllowedRegistries))
+		}
+		break
+	}
 
 	imageCRYAML, err := yaml.Marshal(&imageCR)
 	if err != nil {
@@ -82,33 +109,60 @@ func (e RegistriesExtraction) Transform() (Output, error) {
 
 	return ManifestOutput{
 		Manifests: manifests,
+		Findings:  findings,
 	}, nil
 }
 
 // Extract collects registry information from an OCP3 cluster
 func (e RegistriesTransform) Extract() (Extraction, error) {
 	logrus.Info("RegistriesTransform::Extract")
-	content, err := e.Config.Fetch(env.Config().GetString("RegistriesConfigFile"))
+	registries, err := e.Config.Registries()
 	if err != nil {
 		return nil, err
 	}
 
 	var extraction RegistriesExtraction
-	if _, err := toml.Decode(string(content), &extraction); err != nil {
-		return nil, err
+	extraction.Registries = registries.Registries
+	extraction.Target = e.Config.Target
+	if e.Facts != nil {
+		if policy, ok := e.Facts.Get(FactImagePolicy); ok {
+			imagePolicy := policy.(ImagePolicy)
+			extraction.ImagePolicy = &imagePolicy
+		}
 	}
 	return extraction, nil
 }
 
 // Validate registry data collected from an OCP3 cluster
 func (e RegistriesExtraction) Validate() error {
-	if len(e.Registries["block"].List) == 0 && len(e.Registries["insecure"].List) == 0 {
-		return errors.New("no configured registries detected, not generating a cr")
+	if len(e.Registries["block"].List) == 0 && len(e.Registries["insecure"].List) == 0 && !e.ImagePolicy.merged() {
+		return NothingToMigrate{Reason: "no configured registries detected, not generating a cr"}
 	}
 	return nil
 }
 
+// merged tells the image policy sets fields of the Image CR
+func (p *ImagePolicy) merged() bool {
+	return p != nil && (len(p.AllowedRegistriesForImport) > 0 || p.ExternalRegistryHostname != "")
+}
+
+// Consumes returns the facts the transform reads
+func (e RegistriesTransform) Consumes() []string {
+	return []string{FactImagePolicy}
+}
+
+// WithFacts returns the transform reading its facts from facts
+func (e RegistriesTransform) WithFacts(facts *Facts) Transform {
+	e.Facts = facts
+	return e
+}
+
 // Name returns a human readable name for the transform
 func (e RegistriesTransform) Name() string {
 	return "Registries"
 }
+
+// Description tells what the transform migrates
+func (e RegistriesTransform) Description() string {
+	return "Migrates the blocked, insecure and allowed image registries, with the image policy"
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/BurntSushi/toml"
+	"github.com/fusor/cpma/pkg/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
@@ -57,11 +58,10 @@ func TestRegistriesExtractionTransform(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			actualManifestsChan := make(chan []Manifest)
 
-			// Override flush method
-			manifestOutputFlush = func(manifests []Manifest) error {
+			writer := writerFunc(func(manifests []Manifest) error {
 				actualManifestsChan <- manifests
 				return nil
-			}
+			})
 
 			testExtraction, err := loadRegistriesExtraction()
 			require.NoError(t, err)
@@ -71,7 +71,7 @@ func TestRegistriesExtractionTransform(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				transformOutput.Flush()
+				transformOutput.Flush(writer)
 			}()
 
 			actualManifests := <-actualManifestsChan
@@ -79,3 +79,90 @@ func TestRegistriesExtractionTransform(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistriesExtractionBlockAll(t *testing.T) {
+	registries := map[string]Registries{
+		"search":   {List: []string{"registry.example.com"}},
+		"insecure": {List: []string{"insecure.guy"}},
+		"block":    {List: []string{"all"}},
+	}
+
+	testCases := []struct {
+		name            string
+		targetVersion   string
+		expectedSources RegistrySources
+		expectedMissing []config.Feature
+	}{
+		{
+			name:          "allow search and insecure registries only",
+			targetVersion: "4.3",
+			expectedSources: RegistrySources{
+				AllowedRegistries:  []string{"registry.example.com", "insecure.guy"},
+				InsecureRegistries: []string{"insecure.guy"},
+			},
+		},
+		{
+			name:          "leave allowed registries out before 4.3",
+			targetVersion: "4.1",
+			expectedSources: RegistrySources{
+				InsecureRegistries: []string{"insecure.guy"},
+			},
+			expectedMissing: []config.Feature{config.ImageAllowedRegistries},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := config.NewTarget(tc.targetVersion)
+			require.NoError(t, err)
+
+			extraction := RegistriesExtraction{Registries: registries, Target: target}
+			output, err := extraction.Transform()
+			require.NoError(t, err)
+
+			manifests := output.(ManifestOutput).Manifests
+			require.Len(t, manifests, 1)
+			var imageCR ImageCR
+			require.NoError(t, yaml.Unmarshal(manifests[0].CRD, &imageCR))
+			assert.Equal(t, tc.expectedSources, imageCR.Spec.RegistrySources)
+			assert.Equal(t, tc.expectedMissing, target.Unsupported())
+		})
+	}
+}
+
+func TestRegistriesExtractionImagePolicy(t *testing.T) {
+	extraction, err := loadRegistriesExtraction()
+	require.NoError(t, err)
+	extraction.ImagePolicy = &ImagePolicy{
+		AllowedRegistriesForImport: []RegistryLocation{{DomainName: "quay.io"}, {DomainName: "registry.example.com", Insecure: true}},
+		ExternalRegistryHostname:   "registry.apps.example.com",
+	}
+	require.NoError(t, extraction.Validate())
+
+	output, err := extraction.Transform()
+	require.NoError(t, err)
+
+	var imageCR ImageCR
+	require.NoError(t, yaml.Unmarshal(output.(ManifestOutput).Manifests[0].CRD, &imageCR))
+	assert.Equal(t, extraction.ImagePolicy.AllowedRegistriesForImport, imageCR.Spec.AllowedRegistriesForImport)
+	assert.Equal(t, []string{"registry.apps.example.com"}, imageCR.Spec.ExternalRegistryHostnames)
+	assert.Equal(t, []string{"bad.guy"}, imageCR.Spec.RegistrySources.BlockedRegistries)
+}
+
+func TestRegistriesExtractionValidate(t *testing.T) {
+	err := RegistriesExtraction{ImagePolicy: &ImagePolicy{InternalRegistryHostname: "docker-registry.default.svc:5000"}}.Validate()
+	assert.IsType(t, NothingToMigrate{}, err)
+}
+
+func TestImagePolicyExtractionTransform(t *testing.T) {
+	extraction := ImagePolicyExtraction{ImagePolicy: ImagePolicy{
+		InternalRegistryHostname: "docker-registry.default.svc:5000",
+	}}
+
+	output, err := extraction.Transform()
+	require.NoError(t, err)
+
+	files, findings := output.(ManifestOutput).Describe()
+	assert.Empty(t, files)
+	assert.Equal(t, []string{"Internal registry hostname docker-registry.default.svc:5000 is not migrated, OCP4 sets its own"}, findings)
+}
@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// SchedulerExtraction holds the scheduler configuration extracted from OCP3
+type SchedulerExtraction struct {
+	// DefaultNodeSelector is the node selector of projects without one
+	DefaultNodeSelector string
+	Target              *config.Target
+}
+
+// SchedulerCR is a Scheduler Cluster Resource
+type SchedulerCR struct {
+	APIVersion string        `yaml:"apiVersion"`
+	Kind       string        `yaml:"kind"`
+	Metadata   Metadata      `yaml:"metadata"`
+	Spec       SchedulerSpec `yaml:"spec"`
+}
+
+// SchedulerSpec is a Spec for a SchedulerCR
+type SchedulerSpec struct {
+	DefaultNodeSelector string `yaml:"defaultNodeSelector,omitempty"`
+}
+
+// SchedulerTransform is a scheduler specific transform
+type SchedulerTransform struct {
+	Config *config.Config
+	Facts  *Facts
+}
+
+// Transform converts the scheduler configuration collected from an OCP3
+// cluster to an OCP4 CR
+func (e SchedulerExtraction) Transform() (Output, error) {
+	logrus.Info("SchedulerTransform::Transform")
+
+	const (
+		apiVersion = "config.openshift.io/v1"
+		kind       = "Scheduler"
+		name       = "cluster"
+		annokey    = "release.openshift.io/create-only"
+		annoval    = "true"
+	)
+
+	var output ManifestOutput
+	if !e.Target.Supports(config.SchedulerDefaultNodeSelector) {
+		output.Findings = append(output.Findings, notGenerated(e.Target, config.SchedulerDefaultNodeSelector))
+		return output, nil
+	}
+
+	var schedulerCR SchedulerCR
+	schedulerCR.APIVersion = apiVersion
+	schedulerCR.Kind = kind
+	schedulerCR.Metadata.Name = name
+	schedulerCR.Metadata.Annotations = map[string]string{annokey: annoval}
+	schedulerCR.Spec.DefaultNodeSelector = e.DefaultNodeSelector
+
+	schedulerCRYAML, err := yaml.Marshal(&schedulerCR)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Manifests = append(output.Manifests, Manifest{Name: "100_CPMA-cluster-config-scheduler.yaml", CRD: schedulerCRYAML})
+
+	return output, nil
+}
+
+// Extract reads the default node selector stored by the project transform
+func (e SchedulerTransform) Extract() (Extraction, error) {
+	logrus.Info("SchedulerTransform::Extract")
+
+	var extraction SchedulerExtraction
+	if e.Facts != nil {
+		if selector, ok := e.Facts.Get(FactDefaultNodeSelector); ok {
+			extraction.DefaultNodeSelector = selector.(string)
+		}
+	}
+	extraction.Target = e.Config.Target
+
+	return extraction, nil
+}
+
+// Validate the scheduler configuration collected from an OCP3 cluster
+func (e SchedulerExtraction) Validate() error {
+	if e.DefaultNodeSelector == "" {
+		return NothingToMigrate{Reason: "no default node selector configured, not generating a cr"}
+	}
+	return nil
+}
+
+// Name returns a human readable name for the transform
+func (e SchedulerTransform) Name() string {
+	return "Scheduler"
+}
+
+// Description tells what the transform migrates
+func (e SchedulerTransform) Description() string {
+	return "Sets the default node selector of projects as the Scheduler default"
+}
+
+// Consumes returns the facts the transform reads
+func (e SchedulerTransform) Consumes() []string {
+	return []string{FactDefaultNodeSelector}
+}
+
+// WithFacts returns the transform reading its facts from facts
+func (e SchedulerTransform) WithFacts(facts *Facts) Transform {
+	e.Facts = facts
+	return e
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerExtractionTransform(t *testing.T) {
+	expectedCR := `apiVersion: config.openshift.io/v1
+kind: Scheduler
+metadata:
+  name: cluster
+  annotations:
+    release.openshift.io/create-only: "true"
+spec:
+  defaultNodeSelector: node-role.kubernetes.io/compute=true
+`
+
+	testCases := []struct {
+		name              string
+		targetVersion     string
+		expectedManifests []Manifest
+		expectedMissing   []config.Feature
+	}{
+		{
+			name:          "set the default node selector",
+			targetVersion: "4.3",
+			expectedManifests: []Manifest{
+				{Name: "100_CPMA-cluster-config-scheduler.yaml", CRD: []byte(expectedCR)},
+			},
+		},
+		{
+			name:            "leave the default node selector out before 4.3",
+			targetVersion:   "4.2",
+			expectedMissing: []config.Feature{config.SchedulerDefaultNodeSelector},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := config.NewTarget(tc.targetVersion)
+			require.NoError(t, err)
+
+			extraction := SchedulerExtraction{
+				DefaultNodeSelector: "node-role.kubernetes.io/compute=true",
+				Target:              target,
+			}
+			require.NoError(t, extraction.Validate())
+
+			output, err := extraction.Transform()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedManifests, output.(ManifestOutput).Manifests)
+			assert.Equal(t, tc.expectedMissing, target.Unsupported())
+		})
+	}
+}
+
+func TestSchedulerExtractionValidate(t *testing.T) {
+	err := SchedulerExtraction{}.Validate()
+	assert.IsType(t, NothingToMigrate{}, err)
+}
+
+func TestProjectExtractionTransform(t *testing.T) {
+	expectedCR := `apiVersion: config.openshift.io/v1
+kind: Project
+metadata:
+  name: cluster
+  annotations:
+    release.openshift.io/create-only: "true"
+spec:
+  projectRequestMessage: Ask the cluster admins for a project
+  projectRequestTemplate:
+    name: project-request
+`
+
+	testCases := []struct {
+		name              string
+		extraction        ProjectExtraction
+		expectedManifests []Manifest
+		expectedFindings  []string
+	}{
+		{
+			name: "message and template",
+			extraction: ProjectExtraction{
+				ProjectRequestMessage:  "Ask the cluster admins for a project",
+				ProjectRequestTemplate: "default/project-request",
+			},
+			expectedManifests: []Manifest{
+				{Name: "100_CPMA-cluster-config-project.yaml", CRD: []byte(expectedCR)},
+			},
+			expectedFindings: []string{"Project request template default/project-request is not migrated, create it as project-request in the openshift-config namespace"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.extraction.Validate())
+
+			output, err := tc.extraction.Transform()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedManifests, output.(ManifestOutput).Manifests)
+			assert.Equal(t, tc.expectedFindings, output.(ManifestOutput).Findings)
+		})
+	}
+}
+
+func TestProjectExtractionValidate(t *testing.T) {
+	err := ProjectExtraction{}.Validate()
+	assert.IsType(t, NothingToMigrate{}, err)
+}
+
+func TestSchedulerDefaultNodeSelectorFact(t *testing.T) {
+	getFile := io.GetFile
+	defer func() { io.GetFile = getFile }()
+	io.GetFile = func(host, src, cacheDir string, mode io.CacheMode) ([]byte, error) {
+		return ioutil.ReadFile("../../examples/ocp-3.11/source/etc/origin/master/master-config.yaml")
+	}
+
+	target, err := config.NewTarget("4.3")
+	require.NoError(t, err)
+	cfg := &config.Config{
+		Hostname:         "master-0.test.example.com",
+		MasterConfigFile: "/etc/origin/master/master-config.yaml",
+		Target:           target,
+		Cache:            config.NewCache(),
+	}
+	var flushed []Manifest
+	runner := Runner{Workers: 2, Writer: writerFunc(func(manifests []Manifest) error {
+		flushed = append(flushed, manifests...)
+		return nil
+	})}
+	selected, err := Select([]Transform{ProjectTransform{Config: cfg}, SchedulerTransform{Config: cfg}}, []string{"Scheduler"}, nil)
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+
+	err = runner.Transform(selected)
+	require.NoError(t, err)
+
+	require.Len(t, flushed, 1)
+	assert.Equal(t, "100_CPMA-cluster-config-scheduler.yaml", flushed[0].Name)
+	assert.Contains(t, string(flushed[0].CRD), "defaultNodeSelector: node-role.kubernetes.io/compute=true")
+}
@@ -4,8 +4,6 @@ import (
 	"errors"
 
 	"github.com/fusor/cpma/pkg/config"
-	"github.com/fusor/cpma/pkg/config/decode"
-	"github.com/fusor/cpma/pkg/env"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 
@@ -111,12 +109,7 @@ func SDNTranslate(masterConfig configv1.MasterConfig) (NetworkCR, error) {
 func (e SDNTransform) Extract() (Extraction, error) {
 	logrus.Info("SDNTransform::Extract")
 
-	content, err := e.Config.Fetch(env.Config().GetString("MasterConfigFile"))
-	if err != nil {
-		return nil, err
-	}
-
-	masterConfig, err := decode.MasterConfig(content)
+	masterConfig, err := e.Config.MasterConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -182,3 +175,8 @@ func GenYAML(networkCR NetworkCR) ([]byte, error) {
 func (e SDNTransform) Name() string {
 	return "SDN"
 }
+
+// Description tells what the transform migrates
+func (e SDNTransform) Description() string {
+	return "Migrates the cluster and service networks and the network plugin"
+}
@@ -234,11 +234,10 @@ func TestSDNExtractionTransform(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			actualManifestsChan := make(chan []Manifest)
-			// Override flush method
-			manifestOutputFlush = func(manifests []Manifest) error {
+			writer := writerFunc(func(manifests []Manifest) error {
 				actualManifestsChan <- manifests
 				return nil
-			}
+			})
 
 			testExtraction, err := loadSDNExtraction()
 			require.NoError(t, err)
@@ -248,7 +247,7 @@ func TestSDNExtractionTransform(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				transformOutput.Flush()
+				transformOutput.Flush(writer)
 			}()
 
 			actualManifests := <-actualManifestsChan
@@ -1,6 +1,8 @@
 package secrets
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 
 	"github.com/sirupsen/logrus"
@@ -12,19 +14,15 @@ type HTPasswdFileSecret struct {
 	HTPasswd string `yaml:"htpasswd"`
 }
 
-// KeystoneFileSecret is a keystone secret
-type KeystoneFileSecret struct {
-	Keystone string `yaml:"keystone"`
-}
-
 // LiteralSecret is a literal secret
 type LiteralSecret struct {
 	ClientSecret string `yaml:"clientSecret"`
 }
 
-// BasicAuthFileSecret is a basic auth secret
-type BasicAuthFileSecret struct {
-	BasicAuth string `yaml:"basicAuth"`
+// TLSSecret is a client certificate and its private key
+type TLSSecret struct {
+	Cert string `yaml:"tls.crt"`
+	Key  string `yaml:"tls.key"`
 }
 
 // Secret contains a secret
@@ -46,26 +44,23 @@ type MetaData struct {
 type SecretType int
 
 const (
-	// KeystoneSecretType - keystone type for Secret
-	KeystoneSecretType = iota
 	// HtpasswdSecretType - htpasswd type for Secret
-	HtpasswdSecretType
+	HtpasswdSecretType = iota
 	// LiteralSecretType - literal type for Secret
 	LiteralSecretType
-	// BasicAuthSecretType - basicauth type for Secret
-	BasicAuthSecretType
 )
 
 var typeArray = []string{
-	"KeystoneSecretType",
 	"HtpasswdSecretType",
 	"LiteralSecretType",
-	"BasicAuthSecretType",
 }
 
 // APIVersion is the apiVersion string
 var APIVersion = "v1"
 
+// TLSType is the Kubernetes type of secrets holding a certificate and its key
+const TLSType = "kubernetes.io/tls"
+
 // GenSecret generates a secret
 func GenSecret(name string, secretContent string, namespace string, secretType SecretType) (*Secret, error) {
 	data, err := buildData(secretType, secretContent)
@@ -86,18 +81,37 @@ func GenSecret(name string, secretContent string, namespace string, secretType S
 	return &secret, nil
 }
 
+// GenTLSSecret generates a kubernetes.io/tls secret holding a client
+// certificate and its key. The key is checked to match the certificate.
+func GenTLSSecret(name string, namespace string, crt []byte, key []byte) (*Secret, error) {
+	if _, err := tls.X509KeyPair(crt, key); err != nil {
+		return nil, errors.New("Invalid client certificate and key pair for secret " + name + ": " + err.Error())
+	}
+
+	var secret = Secret{
+		APIVersion: APIVersion,
+		Data: TLSSecret{
+			Cert: base64.StdEncoding.EncodeToString(crt),
+			Key:  base64.StdEncoding.EncodeToString(key),
+		},
+		Kind: "Secret",
+		Type: TLSType,
+		Metadata: MetaData{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	return &secret, nil
+}
+
 func buildData(secretType SecretType, secretContent string) (interface{}, error) {
 	var data interface{}
 
 	switch secretType {
-	case KeystoneSecretType:
-		data = KeystoneFileSecret{Keystone: secretContent}
 	case HtpasswdSecretType:
 		data = HTPasswdFileSecret{HTPasswd: secretContent}
 	case LiteralSecretType:
 		data = LiteralSecret{ClientSecret: secretContent}
-	case BasicAuthSecretType:
-		data = BasicAuthFileSecret{BasicAuth: secretContent}
 	default:
 		return nil, errors.New("Not a valid secret type " + secretType.String())
 	}
@@ -109,7 +123,7 @@ func buildData(secretType SecretType, secretContent string) (interface{}, error)
 func (secret *Secret) GenYAML() ([]byte, error) {
 	yamlBytes, err := yaml.Marshal(&secret)
 	if err != nil {
-		logrus.Debugf("Error in secret, secret - %+v", secret)
+		logrus.Debugf("Error in secret %s", secret.Metadata.Name)
 		return nil, err
 	}
 	return yamlBytes, nil
@@ -117,7 +131,7 @@ func (secret *Secret) GenYAML() ([]byte, error) {
 
 // SecretType.String returns a string representation for SecretType enum
 func (secType SecretType) String() string {
-	if secType >= KeystoneSecretType && int(secType) < len(typeArray) {
+	if secType >= HtpasswdSecretType && int(secType) < len(typeArray) {
 		return typeArray[secType]
 	}
 	return "unknown"
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"encoding/base64"
 	"errors"
 	"io/ioutil"
 	"testing"
@@ -35,40 +36,6 @@ func TestGenSecret(t *testing.T) {
 			},
 			expectederr: false,
 		},
-		{
-			name:            "generate keystone secret",
-			inputSecretName: "keystone-test",
-			inputSecretFile: "testfile2",
-			inputSecretType: KeystoneSecretType,
-			expected: Secret{
-				APIVersion: APIVersion,
-				Data:       KeystoneFileSecret{Keystone: "testfile2"},
-				Kind:       "Secret",
-				Type:       "Opaque",
-				Metadata: MetaData{
-					Name:      "keystone-test",
-					Namespace: "openshift-config",
-				},
-			},
-			expectederr: false,
-		},
-		{
-			name:            "generate basic auth secret",
-			inputSecretName: "basicauth-test",
-			inputSecretFile: "testfile3",
-			inputSecretType: BasicAuthSecretType,
-			expected: Secret{
-				APIVersion: APIVersion,
-				Data:       BasicAuthFileSecret{BasicAuth: "testfile3"},
-				Kind:       "Secret",
-				Type:       "Opaque",
-				Metadata: MetaData{
-					Name:      "basicauth-test",
-					Namespace: "openshift-config",
-				},
-			},
-			expectederr: false,
-		},
 		{
 			name:            "generate litetal secret",
 			inputSecretName: "literal-secret",
@@ -109,6 +76,65 @@ func TestGenSecret(t *testing.T) {
 	}
 }
 
+func TestGenTLSSecret(t *testing.T) {
+	crt, err := ioutil.ReadFile("../testdata/client.crt")
+	require.NoError(t, err)
+	key, err := ioutil.ReadFile("../testdata/client.key")
+	require.NoError(t, err)
+	otherKey, err := ioutil.ReadFile("testdata/other.key")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		inputCrt    []byte
+		inputKey    []byte
+		expected    Secret
+		expectederr bool
+	}{
+		{
+			name:     "generate tls secret",
+			inputCrt: crt,
+			inputKey: key,
+			expected: Secret{
+				APIVersion: APIVersion,
+				Data: TLSSecret{
+					Cert: base64.StdEncoding.EncodeToString(crt),
+					Key:  base64.StdEncoding.EncodeToString(key),
+				},
+				Kind: "Secret",
+				Type: "kubernetes.io/tls",
+				Metadata: MetaData{
+					Name:      "tls-test",
+					Namespace: "openshift-config",
+				},
+			},
+			expectederr: false,
+		},
+		{
+			name:        "fail generating tls secret with mismatched key",
+			inputCrt:    crt,
+			inputKey:    otherKey,
+			expectederr: true,
+		},
+		{
+			name:        "fail generating tls secret without data",
+			expectederr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resSecret, err := GenTLSSecret("tls-test", "openshift-config", tc.inputCrt, tc.inputKey)
+			if tc.expectederr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, &tc.expected, resSecret)
+			}
+		})
+	}
+}
+
 func TestGenYaml(t *testing.T) {
 	expectedYaml, err := ioutil.ReadFile("testdata/expected-secret.yaml")
 	require.NoError(t, err)
@@ -0,0 +1,348 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Strategies select how secrets are written to the output
+const (
+	// RawStrategy writes Secrets as they are
+	RawStrategy = "raw"
+	// SealedStrategy writes Bitnami SealedSecrets
+	SealedStrategy = "sealed"
+	// ExternalStrategy writes ExternalSecrets, the values being imported into
+	// a secret store
+	ExternalStrategy = "external"
+)
+
+// ImportFile is the file of OutputDir holding the values to import into the
+// secret store with the external strategy
+const ImportFile = "secrets-import.json"
+
+// Strategy generates the manifest standing for a secret
+type Strategy interface {
+	GenYAML(secret *Secret) ([]byte, error)
+}
+
+// Importer is implemented by strategies whose values are kept out of the
+// manifests, to be imported separately
+type Importer interface {
+	// WriteImport writes the values of the secrets generated so far to file
+	WriteImport(file string, encrypter *encrypt.Encrypter) error
+}
+
+// NewStrategy creates the strategy of options
+func NewStrategy(options config.SecretsOptions) (Strategy, error) {
+	switch options.Strategy {
+	case "", RawStrategy:
+		return rawStrategy{}, nil
+	case SealedStrategy:
+		return newSealedStrategy(options.Certificate)
+	case ExternalStrategy:
+		return newExternalStrategy(options)
+	default:
+		return nil, errors.New("unknown secrets strategy " + options.Strategy + ", use raw, sealed or external")
+	}
+}
+
+// rawStrategy writes Secrets as they are
+type rawStrategy struct{}
+
+func (rawStrategy) GenYAML(secret *Secret) ([]byte, error) {
+	return secret.GenYAML()
+}
+
+// Values returns the values of the data of the secret, decoded
+func (secret *Secret) Values() (map[string][]byte, error) {
+	content, err := yaml.Marshal(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]string
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(data))
+	for key, value := range data {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			logrus.Warnf("Data %s of secret %s is not base64 encoded, used as is", key, secret.Metadata.Name)
+			decoded = []byte(value)
+		}
+		values[key] = decoded
+	}
+
+	return values, nil
+}
+
+// SealedSecret is a Bitnami SealedSecret
+type SealedSecret struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   MetaData         `yaml:"metadata"`
+	Spec       SealedSecretSpec `yaml:"spec"`
+}
+
+// SealedSecretSpec holds the encrypted data and the Secret the controller
+// creates from it
+type SealedSecretSpec struct {
+	EncryptedData map[string]string `yaml:"encryptedData"`
+	Template      SecretTemplate    `yaml:"template"`
+}
+
+// SecretTemplate is the Secret created from the data
+type SecretTemplate struct {
+	Type     string   `yaml:"type"`
+	Metadata MetaData `yaml:"metadata"`
+}
+
+// sealedStrategy seals secrets offline for the sealed secrets controller, in
+// the strict scope: a sealed value can only be unsealed into a Secret of the
+// same name and namespace
+type sealedStrategy struct {
+	publicKey *rsa.PublicKey
+}
+
+func newSealedStrategy(certificate string) (Strategy, error) {
+	if certificate == "" {
+		return nil, errors.New("the sealed secrets strategy needs the certificate of the controller, set SealedSecretsCertificate")
+	}
+
+	content, err := ioutil.ReadFile(certificate)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New(certificate + ": not a PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New(certificate + ": " + err.Error())
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New(certificate + ": not an RSA certificate")
+	}
+
+	return sealedStrategy{publicKey: publicKey}, nil
+}
+
+func (s sealedStrategy) GenYAML(secret *Secret) ([]byte, error) {
+	values, err := secret.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := SealedSecret{
+		APIVersion: "bitnami.com/v1alpha1",
+		Kind:       "SealedSecret",
+		Metadata:   secret.Metadata,
+		Spec: SealedSecretSpec{
+			EncryptedData: make(map[string]string, len(values)),
+			Template:      SecretTemplate{Type: secret.Type, Metadata: secret.Metadata},
+		},
+	}
+
+	label := []byte(secret.Metadata.Namespace + "/" + secret.Metadata.Name)
+	for key, value := range values {
+		ciphertext, err := hybridEncrypt(s.publicKey, value, label)
+		if err != nil {
+			return nil, err
+		}
+		sealed.Spec.EncryptedData[key] = base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	return yaml.Marshal(&sealed)
+}
+
+// hybridEncrypt encrypts plaintext as the sealed secrets controller expects:
+// a random AES-256-GCM session key, encrypted with RSA-OAEP for the controller
+// with label, prefixed with its length, followed by the sealed plaintext
+func hybridEncrypt(publicKey *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The session key is used once, a zero nonce is safe
+	nonce := make([]byte, aead.NonceSize())
+
+	ciphertext := make([]byte, 2, 2+len(encryptedKey)+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(encryptedKey)))
+	ciphertext = append(ciphertext, encryptedKey...)
+
+	return aead.Seal(ciphertext, nonce, plaintext, nil), nil
+}
+
+// ExternalSecret is an external-secrets.io ExternalSecret
+type ExternalSecret struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   MetaData           `yaml:"metadata"`
+	Spec       ExternalSecretSpec `yaml:"spec"`
+}
+
+// ExternalSecretSpec tells where the values are in the secret store
+type ExternalSecretSpec struct {
+	SecretStoreRef SecretStoreRef       `yaml:"secretStoreRef"`
+	Target         ExternalSecretTarget `yaml:"target"`
+	Data           []ExternalSecretData `yaml:"data"`
+}
+
+// SecretStoreRef is the secret store holding the values
+type SecretStoreRef struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+}
+
+// ExternalSecretTarget is the Secret created from the values
+type ExternalSecretTarget struct {
+	Name     string         `yaml:"name"`
+	Template TargetTemplate `yaml:"template"`
+}
+
+// TargetTemplate is the template of the Secret created
+type TargetTemplate struct {
+	Type string `yaml:"type"`
+}
+
+// ExternalSecretData maps a key of the Secret to a value of the store
+type ExternalSecretData struct {
+	SecretKey string    `yaml:"secretKey"`
+	RemoteRef RemoteRef `yaml:"remoteRef"`
+}
+
+// RemoteRef locates a value in the store
+type RemoteRef struct {
+	Key      string `yaml:"key"`
+	Property string `yaml:"property"`
+}
+
+// externalStrategy references the values of secrets in a secret store, and
+// keeps them for the import file
+type externalStrategy struct {
+	store   SecretStoreRef
+	prefix  string
+	mutex   *sync.Mutex
+	imports map[string]map[string]string
+}
+
+func newExternalStrategy(options config.SecretsOptions) (Strategy, error) {
+	if options.Store == "" {
+		return nil, errors.New("the external secrets strategy needs a secret store, set ExternalSecretStore")
+	}
+
+	kind := options.StoreKind
+	if kind == "" {
+		kind = "ClusterSecretStore"
+	}
+	if kind != "ClusterSecretStore" && kind != "SecretStore" {
+		return nil, errors.New("unknown secret store kind " + kind + ", use SecretStore or ClusterSecretStore")
+	}
+
+	return externalStrategy{
+		store:   SecretStoreRef{Name: options.Store, Kind: kind},
+		prefix:  options.Prefix,
+		mutex:   &sync.Mutex{},
+		imports: make(map[string]map[string]string),
+	}, nil
+}
+
+func (s externalStrategy) GenYAML(secret *Secret) ([]byte, error) {
+	values, err := secret.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	path := secret.Metadata.Namespace + "/" + secret.Metadata.Name
+	if s.prefix != "" {
+		path = s.prefix + "/" + path
+	}
+
+	external := ExternalSecret{
+		APIVersion: "external-secrets.io/v1beta1",
+		Kind:       "ExternalSecret",
+		Metadata:   secret.Metadata,
+		Spec: ExternalSecretSpec{
+			SecretStoreRef: s.store,
+			Target: ExternalSecretTarget{
+				Name:     secret.Metadata.Name,
+				Template: TargetTemplate{Type: secret.Type},
+			},
+		},
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	imported := make(map[string]string, len(values))
+	for _, key := range keys {
+		external.Spec.Data = append(external.Spec.Data, ExternalSecretData{
+			SecretKey: key,
+			RemoteRef: RemoteRef{Key: path, Property: key},
+		})
+		imported[key] = string(values[key])
+	}
+
+	s.mutex.Lock()
+	s.imports[path] = imported
+	s.mutex.Unlock()
+
+	return yaml.Marshal(&external)
+}
+
+// WriteImport writes the values of the secrets as a JSON object of the paths in
+// the store, each one holding the values by key. The file is protected as the
+// Secrets are, see encrypt.WriteFile.
+func (s externalStrategy) WriteImport(file string, encrypter *encrypt.Encrypter) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.imports) == 0 {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.imports, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return encrypt.WriteFile(file, append(content, '\n'), encrypter)
+}
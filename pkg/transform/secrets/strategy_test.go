@@ -0,0 +1,186 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+// hybridDecrypt opens a value sealed by hybridEncrypt, as the controller does
+func hybridDecrypt(privateKey *rsa.PrivateKey, ciphertext, label []byte) ([]byte, error) {
+	keyLen := int(binary.BigEndian.Uint16(ciphertext))
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext[2:2+keyLen], label)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, make([]byte, aead.NonceSize()), ciphertext[2+keyLen:], nil)
+}
+
+// writeCertificate writes the self-signed certificate of a new controller key
+func writeCertificate(t *testing.T, file string) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+
+	return privateKey
+}
+
+func TestSealedStrategy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certificate := filepath.Join(dir, "cert.pem")
+	privateKey := writeCertificate(t, certificate)
+
+	strategy, err := NewStrategy(config.SecretsOptions{Strategy: SealedStrategy, Certificate: certificate})
+	require.NoError(t, err)
+
+	secret, err := GenSecret("htpasswd_auth-secret", base64.StdEncoding.EncodeToString([]byte("user:password")), "openshift-config", HtpasswdSecretType)
+	require.NoError(t, err)
+	content, err := strategy.GenYAML(secret)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "user:password")
+
+	var sealed SealedSecret
+	require.NoError(t, yaml.Unmarshal(content, &sealed))
+	assert.Equal(t, "bitnami.com/v1alpha1", sealed.APIVersion)
+	assert.Equal(t, "SealedSecret", sealed.Kind)
+	assert.Equal(t, secret.Metadata, sealed.Metadata)
+	assert.Equal(t, SecretTemplate{Type: "Opaque", Metadata: secret.Metadata}, sealed.Spec.Template)
+	require.Len(t, sealed.Spec.EncryptedData, 1)
+
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed.Spec.EncryptedData["htpasswd"])
+	require.NoError(t, err)
+	plaintext, err := hybridDecrypt(privateKey, ciphertext, []byte("openshift-config/htpasswd_auth-secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "user:password", string(plaintext))
+
+	// Strict scope, the value cannot be unsealed into another secret
+	_, err = hybridDecrypt(privateKey, ciphertext, []byte("openshift-config/other-secret"))
+	assert.Error(t, err)
+}
+
+func TestExternalStrategy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpma-secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	strategy, err := NewStrategy(config.SecretsOptions{Strategy: ExternalStrategy, Store: "vault", Prefix: "ocp3"})
+	require.NoError(t, err)
+
+	secret, err := GenSecret("github-secret", base64.StdEncoding.EncodeToString([]byte("s3cr3t")), "openshift-config", LiteralSecretType)
+	require.NoError(t, err)
+	content, err := strategy.GenYAML(secret)
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: github-secret
+  namespace: openshift-config
+spec:
+  secretStoreRef:
+    name: vault
+    kind: ClusterSecretStore
+  target:
+    name: github-secret
+    template:
+      type: Opaque
+  data:
+  - secretKey: clientSecret
+    remoteRef:
+      key: ocp3/openshift-config/github-secret
+      property: clientSecret
+`, string(content))
+
+	importFile := filepath.Join(dir, ImportFile)
+	require.NoError(t, strategy.(Importer).WriteImport(importFile, nil))
+	content, err = ioutil.ReadFile(importFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ocp3/openshift-config/github-secret": {"clientSecret": "s3cr3t"}}`, string(content))
+	info, err := os.Stat(importFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestNewStrategy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		options     config.SecretsOptions
+		expectederr string
+	}{
+		{
+			name:    "raw by default",
+			options: config.SecretsOptions{},
+		},
+		{
+			name:        "unknown strategy",
+			options:     config.SecretsOptions{Strategy: "vault"},
+			expectederr: "unknown secrets strategy vault",
+		},
+		{
+			name:        "sealed without certificate",
+			options:     config.SecretsOptions{Strategy: SealedStrategy},
+			expectederr: "set SealedSecretsCertificate",
+		},
+		{
+			name:        "external without store",
+			options:     config.SecretsOptions{Strategy: ExternalStrategy},
+			expectederr: "set ExternalSecretStore",
+		},
+		{
+			name:        "external with unknown store kind",
+			options:     config.SecretsOptions{Strategy: ExternalStrategy, Store: "vault", StoreKind: "Vault"},
+			expectederr: "unknown secret store kind Vault",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewStrategy(tc.options)
+			if tc.expectederr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectederr)
+		})
+	}
+}
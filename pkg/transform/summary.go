@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/redact"
+	"github.com/sirupsen/logrus"
+)
+
+// SummaryFile is the file of OutputDir summarizing the run
+const SummaryFile = "summary.json"
+
+// Statuses of transforms
+const (
+	// StatusSucceeded means the transform generated its manifests
+	StatusSucceeded = "succeeded"
+	// StatusFailed means the transform ran but failed
+	StatusFailed = "failed"
+	// StatusNotApplicable means the transform found nothing to migrate
+	StatusNotApplicable = "notApplicable"
+	// StatusSkipped means the transform did not run, as its prerequisites
+	// failed or it does not support the source version
+	StatusSkipped = "skipped"
+)
+
+// Statuses of runs
+const (
+	// RunSucceeded means every transform succeeded, or had nothing to migrate
+	RunSucceeded = "success"
+	// RunPartial means some transforms succeeded, not all
+	RunPartial = "partial"
+	// RunFailed means no transform succeeded, or the output could not be written
+	RunFailed = "failed"
+)
+
+// TransformResult is the outcome of a transform
+type TransformResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Files are the names of the manifests generated
+	Files    []string `json:"files,omitempty"`
+	Findings []string `json:"findings,omitempty"`
+	// Started is when the transform started, nil if it was skipped
+	Started         *time.Time `json:"started,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds"`
+
+	// fetchFailed tells the cluster could not be reached
+	fetchFailed bool
+}
+
+// Summary is the machine-readable outcome of a transform run
+type Summary struct {
+	Status          string            `json:"status"`
+	ExitCode        int               `json:"exitCode"`
+	Error           string            `json:"error,omitempty"`
+	SourceVersion   string            `json:"sourceVersion,omitempty"`
+	TargetVersion   string            `json:"targetVersion,omitempty"`
+	OutputFormat    string            `json:"outputFormat"`
+	Started         time.Time         `json:"started"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Transforms      []TransformResult `json:"transforms"`
+}
+
+// NewSummary starts the summary of a run with config
+func NewSummary(config *config.Config) *Summary {
+	summary := &Summary{
+		OutputFormat: config.OutputFormat,
+		Started:      time.Now(),
+	}
+	if config.Target != nil {
+		summary.TargetVersion = config.Target.Version.String()
+	}
+	if summary.OutputFormat == "" {
+		summary.OutputFormat = DefaultOutputFormat
+	}
+
+	return summary
+}
+
+// Finish sets the status and exit code of the run, which ended with err:
+// env.ExitSuccess, env.ExitPartial if some transforms succeeded and others
+// did not, and when none did, env.ExitFetchError if the cluster could not be
+// reached, see io.IsUnreachable, env.ExitError otherwise, files missing on
+// the cluster included. Configuration errors are
+// env.ExitConfigError.
+func (s *Summary) Finish(err error) {
+	s.DurationSeconds = time.Since(s.Started).Seconds()
+	if err != nil {
+		s.Error = redact.String(err.Error())
+	}
+
+	succeeded, fetchFailed := 0, false
+	for _, result := range s.Transforms {
+		// Transforms with nothing to migrate do not make a run partial
+		if result.Status == StatusSucceeded {
+			succeeded++
+		}
+		fetchFailed = fetchFailed || result.fetchFailed
+	}
+	var transformErrs TransformErrors
+	transformsFailed := errors.As(err, &transformErrs)
+
+	switch {
+	case err == nil:
+		s.Status, s.ExitCode = RunSucceeded, env.ExitSuccess
+	case env.IsConfigError(err):
+		s.Status, s.ExitCode = RunFailed, env.ExitConfigError
+	case transformsFailed && succeeded > 0:
+		s.Status, s.ExitCode = RunPartial, env.ExitPartial
+	case fetchFailed:
+		s.Status, s.ExitCode = RunFailed, env.ExitFetchError
+	default:
+		s.Status, s.ExitCode = RunFailed, env.ExitError
+	}
+}
+
+// Write writes the summary as JSON to dir/SummaryFile
+func (s *Summary) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, SummaryFile)
+	if err := ioutil.WriteFile(file, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	logrus.Infof("Summary written to %s", file)
+
+	return nil
+}
+
+// start records the transform is starting
+func (r *TransformResult) start() {
+	now := time.Now()
+	r.Started = &now
+}
+
+// stop records the transform is done
+func (r *TransformResult) stop() {
+	r.DurationSeconds = time.Since(*r.Started).Seconds()
+}
+
+// finish records the outcome of the transform, output being nil if it failed
+// or did not run
+func (r *TransformResult) finish(output Output, err error) {
+	switch {
+	case r.Started == nil:
+		r.Status = StatusSkipped
+	case err != nil:
+		r.Status = StatusFailed
+	case isNotApplicable(output):
+		r.Status = StatusNotApplicable
+	default:
+		r.Status = StatusSucceeded
+	}
+
+	if err != nil {
+		r.Error = redact.String(err.Error())
+		r.fetchFailed = io.IsUnreachable(err)
+	}
+
+	if describer, ok := output.(Describer); ok && err == nil {
+		r.Files, r.Findings = describer.Describe()
+	}
+}
+
+// isNotApplicable tells the transform had nothing to migrate
+func isNotApplicable(output Output) bool {
+	_, ok := output.(notApplicable)
+	return ok
+}
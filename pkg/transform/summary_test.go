@@ -0,0 +1,240 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/env"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerResults(t *testing.T) {
+	var flushed []string
+	var flushMutex sync.Mutex
+	var running, maxRunning int32
+	fake := func(name string, extractErr error, dependsOn ...string) fakeTransform {
+		return fakeTransform{
+			name:       name,
+			extractErr: extractErr,
+			dependsOn:  dependsOn,
+			flushed:    &flushed,
+			flushMutex: &flushMutex,
+			running:    &running,
+			maxRunning: &maxRunning,
+		}
+	}
+
+	runner := Runner{Workers: 2}
+	results, err := runner.run([]Transform{
+		fake("OAuth", nil),
+		fake("SDN", errors.New("no network config")),
+		fake("Registries", nil, "SDN"),
+	}, runTransform)
+	require.Error(t, err)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, "OAuth", results[0].Name)
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.NotNil(t, results[0].Started)
+	assert.Equal(t, "SDN", results[1].Name)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, "no network config", results[1].Error)
+	assert.Equal(t, "Registries", results[2].Name)
+	assert.Equal(t, StatusSkipped, results[2].Status)
+	assert.Equal(t, "prerequisite SDN failed", results[2].Error)
+	assert.Nil(t, results[2].Started)
+}
+
+func TestRunnerNothingToMigrate(t *testing.T) {
+	var flushed []string
+	var running, maxRunning int32
+	fake := func(name string, validateErr error, dependsOn ...string) fakeTransform {
+		return fakeTransform{
+			name:        name,
+			validateErr: validateErr,
+			dependsOn:   dependsOn,
+			flushed:     &flushed,
+			flushMutex:  &sync.Mutex{},
+			running:     &running,
+			maxRunning:  &maxRunning,
+		}
+	}
+
+	runner := Runner{Workers: 2}
+	results, err := runner.run([]Transform{
+		fake("OAuth", nil),
+		fake("APIServer", NothingToMigrate{Reason: "no encryption nor auditing configured, not generating a cr"}),
+		fake("Registries", nil, "APIServer"),
+	}, runTransform)
+	require.NoError(t, err)
+
+	require.Len(t, results, 3)
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, "APIServer", results[1].Name)
+	assert.Equal(t, StatusNotApplicable, results[1].Status)
+	assert.Empty(t, results[1].Error)
+	assert.Equal(t, []string{"no encryption nor auditing configured, not generating a cr"}, results[1].Findings)
+	assert.Equal(t, StatusSucceeded, results[2].Status)
+	assert.Equal(t, []string{"OAuth", "Registries"}, flushed)
+
+	summary := Summary{Transforms: results}
+	summary.Finish(err)
+	assert.Equal(t, RunSucceeded, summary.Status)
+	assert.Equal(t, env.ExitSuccess, summary.ExitCode)
+}
+
+func TestTransformResultDescribe(t *testing.T) {
+	var result TransformResult
+	result.start()
+	result.stop()
+	result.finish(ManifestOutput{
+		Manifests: []Manifest{{Name: "100_CPMA-cluster-config-registries.yaml"}},
+		Findings:  []string{"Image spec.registrySources.allowedRegistries not generated"},
+	}, nil)
+
+	assert.Equal(t, StatusSucceeded, result.Status)
+	assert.Equal(t, []string{"100_CPMA-cluster-config-registries.yaml"}, result.Files)
+	assert.Equal(t, []string{"Image spec.registrySources.allowedRegistries not generated"}, result.Findings)
+}
+
+func TestSummaryFinish(t *testing.T) {
+	fetchErr := &sftpclient.FetchError{
+		Kind: sftpclient.NetworkError,
+		Host: "master-0.test.example.com",
+		Path: "/etc/origin/master/master-config.yaml",
+		Err:  errors.New("connection refused"),
+	}
+	succeeded := TransformResult{Name: "OAuth", Status: StatusSucceeded}
+	notApplicable := TransformResult{Name: "APIServer", Status: StatusNotApplicable}
+	failed := TransformResult{Name: "SDN", Status: StatusFailed}
+	fetchFailed := TransformResult{Name: "Registries", Status: StatusFailed}
+	fetchFailed.finish(nil, fetchErr)
+	notFound := TransformResult{Name: "Registries", Status: StatusFailed}
+	notFound.finish(nil, &sftpclient.FetchError{
+		Kind: sftpclient.NotFoundError,
+		Host: "master-0.test.example.com",
+		Path: "/etc/containers/registries.conf",
+		Err:  errors.New("file does not exist"),
+	})
+	transformErrs := TransformErrors{{Transform: "SDN", Err: errors.New("failed")}}
+
+	testCases := []struct {
+		name             string
+		transforms       []TransformResult
+		err              error
+		expectedStatus   string
+		expectedExitCode int
+	}{
+		{
+			name:             "success",
+			transforms:       []TransformResult{succeeded},
+			expectedStatus:   RunSucceeded,
+			expectedExitCode: env.ExitSuccess,
+		},
+		{
+			name:             "partial",
+			transforms:       []TransformResult{succeeded, failed, fetchFailed},
+			err:              transformErrs,
+			expectedStatus:   RunPartial,
+			expectedExitCode: env.ExitPartial,
+		},
+		{
+			name:             "nothing to migrate",
+			transforms:       []TransformResult{succeeded, notApplicable},
+			expectedStatus:   RunSucceeded,
+			expectedExitCode: env.ExitSuccess,
+		},
+		{
+			name:             "failed with nothing to migrate",
+			transforms:       []TransformResult{notApplicable, failed},
+			err:              transformErrs,
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitError,
+		},
+		{
+			name:             "partial, wrapped errors",
+			transforms:       []TransformResult{succeeded, failed},
+			err:              fmt.Errorf("transform: %w", transformErrs),
+			expectedStatus:   RunPartial,
+			expectedExitCode: env.ExitPartial,
+		},
+		{
+			name:             "fetch error",
+			transforms:       []TransformResult{failed, fetchFailed},
+			err:              transformErrs,
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitFetchError,
+		},
+		{
+			name:             "missing file",
+			transforms:       []TransformResult{failed, notFound},
+			err:              transformErrs,
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitError,
+		},
+		{
+			name:             "all failed",
+			transforms:       []TransformResult{failed},
+			err:              transformErrs,
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitError,
+		},
+		{
+			name:             "config error",
+			err:              env.ConfigError{Err: errors.New("unknown output format")},
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitConfigError,
+		},
+		{
+			name:             "output error",
+			transforms:       []TransformResult{succeeded},
+			err:              errors.New("disk full"),
+			expectedStatus:   RunFailed,
+			expectedExitCode: env.ExitError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			summary := Summary{Transforms: tc.transforms}
+			summary.Finish(tc.err)
+			assert.Equal(t, tc.expectedStatus, summary.Status)
+			assert.Equal(t, tc.expectedExitCode, summary.ExitCode)
+		})
+	}
+}
+
+func TestSummaryWrite(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-summary")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	summary := Summary{
+		TargetVersion: "4.2",
+		OutputFormat:  DefaultOutputFormat,
+		Transforms: []TransformResult{
+			{Name: "OAuth", Status: StatusSucceeded, Files: []string{"100_CPMA-cluster-config-oauth.yaml"}},
+			{Name: "SDN", Status: StatusFailed, Error: "no network config"},
+		},
+	}
+	summary.Finish(TransformErrors{{Transform: "SDN", Err: errors.New("no network config")}})
+	require.NoError(t, summary.Write(outputDir))
+
+	content, err := ioutil.ReadFile(filepath.Join(outputDir, SummaryFile))
+	require.NoError(t, err)
+
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &written))
+	assert.Equal(t, RunPartial, written["status"])
+	assert.Equal(t, float64(env.ExitPartial), written["exitCode"])
+	assert.Equal(t, "4.2", written["targetVersion"])
+	assert.Len(t, written["transforms"], 2)
+}
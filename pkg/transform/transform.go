@@ -1,7 +1,18 @@
 package transform
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
 	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/fusor/cpma/pkg/env"
 	"github.com/fusor/cpma/pkg/transform/configmaps"
 	"github.com/fusor/cpma/pkg/transform/oauth"
 	"github.com/fusor/cpma/pkg/transform/secrets"
@@ -36,9 +47,24 @@ type Manifest struct {
 
 // Runner a generic transform runner
 type Runner struct {
-	Config string
+	Config  string
+	Workers int
+	// Version is the source cluster release, transforms are not checked
+	// against it when unknown
+	Version config.Version
+	// Writer writes the outputs of the transforms
+	Writer Writer
+}
+
+// TransformError is the error a transform failed with
+type TransformError struct {
+	Transform string
+	Err       error
 }
 
+// TransformErrors aggregates the errors of all failed transforms
+type TransformErrors []TransformError
+
 // Extraction is a generic data extraction
 type Extraction interface {
 	Transform() (Output, error)
@@ -51,70 +77,436 @@ type Transform interface {
 	Name() string
 }
 
+// Documented is implemented by transforms describing what they migrate, for
+// cpma transform list
+type Documented interface {
+	Description() string
+}
+
+// VersionConstrained is implemented by transforms which support only some
+// source cluster releases. Transforms reading what every OCP3 release has do
+// not implement it.
+type VersionConstrained interface {
+	SourceVersions() config.VersionRange
+}
+
 // Output is a generic output type
 type Output interface {
-	Flush() error
+	Flush(writer Writer) error
+}
+
+// Describer is implemented by outputs telling the run summary what they hold:
+// the names of the manifests, and what the transform noticed, such as settings
+// not migrated
+type Describer interface {
+	Describe() (files []string, findings []string)
+}
+
+// NothingToMigrate is returned by Validate when the OCP3 cluster does not use
+// what the transform migrates. The transform is then reported as not
+// applicable, not as failed.
+type NothingToMigrate struct {
+	Reason string
+}
+
+// notApplicable is the output of a transform with nothing to migrate
+type notApplicable struct {
+	reason string
 }
 
 //Start generating manifests to be used with Openshift 4
-func Start() {
-	config := config.LoadConfig()
+//The summary of the run is written to OutputDir/SummaryFile and returned, nil
+//if the configuration could not be loaded
+func Start() (*Summary, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	summary := NewSummary(&config)
+
+	selected, err := Transforms(&config)
+	if err != nil {
+		err = env.ConfigError{Err: err}
+		summary.Finish(err)
+		return summary, err
+	}
+
+	encrypter, err := encrypt.NewEncrypter(config.EncryptionKeys)
+	if err != nil {
+		err = env.ConfigError{Err: err}
+		summary.Finish(err)
+		return summary, err
+	}
+	secretsStrategy, err := secrets.NewStrategy(config.Secrets)
+	if err != nil {
+		err = env.ConfigError{Err: err}
+		summary.Finish(err)
+		return summary, err
+	}
+
+	writer, err := NewWriter(config.OutputFormat, WriterOptions{
+		OutputDir: config.OutputDir,
+		Stdout:    os.Stdout,
+		Encrypter: encrypter,
+	})
+	if err != nil {
+		err = env.ConfigError{Err: err}
+		summary.Finish(err)
+		return summary, err
+	}
+
 	runner := NewRunner(config)
+	runner.Writer = writer
+	runner.detectVersion(&config)
+	if !runner.Version.IsZero() {
+		summary.SourceVersion = runner.Version.String()
+	}
+
+	summary.Transforms, err = runner.run(selected, runTransform)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if importer, ok := secretsStrategy.(secrets.Importer); ok {
+		importFile := filepath.Join(config.OutputDir, secrets.ImportFile)
+		if importErr := importer.WriteImport(importFile, encrypter); err == nil {
+			err = importErr
+		}
+	}
+	for _, feature := range config.Target.Unsupported() {
+		logrus.Warnf("Not generated for OCP %s: %s needs OCP %s or later", config.Target.Version, feature, feature.Since())
+	}
+
+	summary.Finish(err)
+	if writeErr := summary.Write(config.OutputDir); err == nil {
+		err = writeErr
+	}
 
-	runner.Transform([]Transform{
+	return summary, err
+}
+
+// Transforms returns the transforms run with config, selected with Only and
+// Skip
+func Transforms(config *config.Config) ([]Transform, error) {
+	return Select(transforms(config), config.Only, config.Skip)
+}
+
+// transforms returns every transform, in the order they run with config
+func transforms(config *config.Config) []Transform {
+	return []Transform{
 		OAuthTransform{
-			Config: &config,
+			Config: config,
 		},
 		SDNTransform{
-			Config: &config,
+			Config: config,
+		},
+		ImagePolicyTransform{
+			Config: config,
 		},
 		RegistriesTransform{
-			Config: &config,
+			Config: config,
 		},
-	})
+		APIServerTransform{
+			Config: config,
+		},
+		ProjectTransform{
+			Config: config,
+		},
+		SchedulerTransform{
+			Config: config,
+		},
+	}
 }
 
-// Transform is the process run to complete a transform
-func (r Runner) Transform(transforms []Transform) {
-	logrus.Info("TransformRunner::Transform")
+// Select returns the transforms named in only, all if empty, but those named
+// in skip. Names are those of Name(), compared regardless of case. The
+// prerequisites of the transforms named in only, see Dependent and
+// FactConsumer, are selected too, unless skipped.
+func Select(transforms []Transform, only, skip []string) ([]Transform, error) {
+	byName := make(map[string]Transform, len(transforms))
+	producers := make(map[string][]string)
+	for _, transform := range transforms {
+		key := strings.ToLower(transform.Name())
+		byName[key] = transform
+		if producer, ok := transform.(FactProducer); ok {
+			for _, fact := range producer.Produces() {
+				producers[fact] = append(producers[fact], transform.Name())
+			}
+		}
+	}
+
+	lookup := func(names []string) (map[string]bool, error) {
+		found := make(map[string]bool, len(names))
+		for _, name := range names {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if key == "" {
+				continue
+			}
+			if _, ok := byName[key]; !ok {
+				return nil, errors.New("unknown transform " + name + ", run cpma transform list")
+			}
+			found[key] = true
+		}
+		return found, nil
+	}
+
+	skipped, err := lookup(skip)
+	if err != nil {
+		return nil, err
+	}
+	wanted, err := lookup(only)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wanted) > 0 {
+		var pending []string
+		for name := range wanted {
+			pending = append(pending, name)
+		}
+		for len(pending) > 0 {
+			name := pending[0]
+			pending = pending[1:]
+
+			var prerequisites []string
+			if dependent, ok := byName[name].(Dependent); ok {
+				prerequisites = append(prerequisites, dependent.DependsOn()...)
+			}
+			if consumer, ok := byName[name].(FactConsumer); ok {
+				for _, fact := range consumer.Consumes() {
+					prerequisites = append(prerequisites, producers[fact]...)
+				}
+			}
+			for _, prerequisite := range prerequisites {
+				key := strings.ToLower(prerequisite)
+				if _, ok := byName[key]; !ok || wanted[key] {
+					continue
+				}
+				logrus.Infof("Selected %s, needed by %s", prerequisite, byName[name].Name())
+				wanted[key] = true
+				pending = append(pending, key)
+			}
+		}
+	}
 
-	// For each transform, extract the data, validate it, and run the transform.
-	// Handle any errors, and finally flush the output to it's desired destination
-	// NOTE: This should be parallelized with channels unless the transforms have
-	// some dependency on the outputs of others
+	var selected []Transform
 	for _, transform := range transforms {
-		extraction, err := transform.Extract()
-		if err != nil {
-			HandleError(err, transform.Name())
+		key := strings.ToLower(transform.Name())
+		if skipped[key] || (len(wanted) > 0 && !wanted[key]) {
 			continue
 		}
+		selected = append(selected, transform)
+	}
 
-		if err := extraction.Validate(); err != nil {
-			HandleError(err, transform.Name())
-			continue
+	return selected, nil
+}
+
+// PrintTransforms writes the name and description of every transform
+func PrintTransforms(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDESCRIPTION")
+	for _, transform := range transforms(&config.Config{}) {
+		description := ""
+		if documented, ok := transform.(Documented); ok {
+			description = documented.Description()
 		}
+		fmt.Fprintf(tw, "%s\t%s\n", transform.Name(), description)
+	}
 
-		output, err := extraction.Transform()
-		if err != nil {
-			HandleError(err, transform.Name())
-			continue
+	return tw.Flush()
+}
+
+// notGenerated is the finding of a feature left out of the manifests, as the
+// target release does not understand it
+func notGenerated(target *config.Target, feature config.Feature) string {
+	version := config.DefaultTargetVersion
+	if target != nil {
+		version = target.Version
+	}
+
+	return string(feature) + " not generated, it needs OCP " + feature.Since().String() + " or later, not " + version.String()
+}
+
+// detectVersion sets the runner's Version to the source cluster release, if
+// it can be told
+func (r *Runner) detectVersion(config *config.Config) {
+	version, err := config.SourceVersion()
+	if err != nil {
+		logrus.Warn(err)
+		return
+	}
+
+	logrus.Infof("Source version: %s", version)
+	r.Version = version.Version
+}
+
+// Transform is the process run to complete a transform
+// Transforms are ordered so that each one runs after the transforms it depends
+// on, and independent transforms run concurrently, up to Workers at a time.
+// A transform whose prerequisite failed is skipped. Outputs are then flushed in
+// dependency order, ties keeping the given order, so the result does not depend
+// on scheduling. Errors are collected per transform and returned as TransformErrors.
+// Each run has its own Facts, given to the transforms which are FactUsers.
+// Transforms not supporting the source version, see VersionConstrained, are skipped.
+func (r Runner) Transform(transforms []Transform) error {
+	logrus.Info("TransformRunner::Transform")
+
+	_, err := r.run(transforms, runTransform)
+	return err
+}
+
+// Extract only extracts the data of each transform, fetching the files they
+// need, scheduled as with Transform. Nothing is translated nor flushed.
+func (r Runner) Extract(transforms []Transform) error {
+	logrus.Info("TransformRunner::Extract")
+
+	_, err := r.run(transforms, func(transform Transform) (Output, error) {
+		_, err := transform.Extract()
+		return nil, err
+	})
+	return err
+}
+
+// run schedules f over transforms and flushes the outputs, see Transform. It
+// returns the result of each transform, in the order they were flushed.
+func (r Runner) run(transforms []Transform, f func(Transform) (Output, error)) ([]TransformResult, error) {
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	transforms = withFacts(transforms, NewFacts())
+	order, deps, errs := sortTransforms(transforms)
+	for i, transform := range transforms {
+		if errs[i] == nil {
+			errs[i] = r.checkVersion(transform)
 		}
+	}
+	outputs := make([]Output, len(transforms))
+	results := make([]TransformResult, len(transforms))
+	done := make([]chan struct{}, len(transforms))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, workers)
 
-		if err := output.Flush(); err != nil {
-			HandleError(err, transform.Name())
-			continue
+	var wg sync.WaitGroup
+	for _, i := range order {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+
+			if errs[i] != nil {
+				return
+			}
+
+			for _, d := range deps[i] {
+				<-done[d]
+				if errs[d] != nil {
+					errs[i] = errors.New("prerequisite " + transforms[d].Name() + " failed")
+					return
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i].start()
+			outputs[i], errs[i] = f(transforms[i])
+			results[i].stop()
+		}(i)
+	}
+	wg.Wait()
+
+	var failed TransformErrors
+	sorted := make([]TransformResult, 0, len(transforms))
+	for _, i := range order {
+		if errs[i] == nil && outputs[i] != nil {
+			errs[i] = outputs[i].Flush(r.Writer)
 		}
+
+		results[i].Name = transforms[i].Name()
+		results[i].finish(outputs[i], errs[i])
+		sorted = append(sorted, results[i])
+
+		if errs[i] != nil {
+			failed = append(failed, TransformError{Transform: transforms[i].Name(), Err: errs[i]})
+		}
+	}
+
+	if len(failed) > 0 {
+		return sorted, failed
+	}
+
+	return sorted, nil
+}
+
+// checkVersion tells whether transform supports the source version
+func (r Runner) checkVersion(transform Transform) error {
+	constrained, ok := transform.(VersionConstrained)
+	if !ok || r.Version.IsZero() {
+		return nil
 	}
+
+	versions := constrained.SourceVersions()
+	if !versions.Contains(r.Version) {
+		return errors.New("source version " + r.Version.String() + " not supported, needs " + versions.String())
+	}
+
+	return nil
+}
+
+// runTransform extracts the data, validates it, and runs the transform
+func runTransform(transform Transform) (Output, error) {
+	extraction, err := transform.Extract()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := extraction.Validate(); err != nil {
+		var nothing NothingToMigrate
+		if errors.As(err, &nothing) {
+			logrus.Infof("%s: %s", transform.Name(), nothing.Reason)
+			return notApplicable{reason: nothing.Reason}, nil
+		}
+		return nil, err
+	}
+
+	return extraction.Transform()
 }
 
 // NewRunner creates a new Runner
 func NewRunner(config config.Config) *Runner {
-	return &Runner{}
+	return &Runner{Workers: config.Workers}
 }
 
-// HandleError handles errors
-func HandleError(err error, transformType string) error {
-	logrus.Warnf("Skipping %s, see error below\n", transformType)
-	logrus.Warnf("%s\n", err)
-	return err
+func (e TransformError) Error() string {
+	return e.Transform + ": " + e.Err.Error()
+}
+
+func (e NothingToMigrate) Error() string {
+	return e.Reason
+}
+
+// Flush writes nothing
+func (o notApplicable) Flush(writer Writer) error {
+	return nil
+}
+
+// Describe reports why there was nothing to migrate
+func (o notApplicable) Describe() (files []string, findings []string) {
+	return nil, []string{o.reason}
+}
+
+// Unwrap returns the error the transform failed with
+func (e TransformError) Unwrap() error {
+	return e.Err
+}
+
+func (e TransformErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "skipped transforms: " + strings.Join(msgs, "; ")
 }
@@ -0,0 +1,393 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fusor/cpma/pkg/config"
+	"github.com/fusor/cpma/pkg/io"
+	"github.com/fusor/cpma/pkg/io/sftpclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTransform struct {
+	name        string
+	delay       time.Duration
+	extractErr  error
+	validateErr error
+	flushed     *[]string
+	flushMutex  *sync.Mutex
+	running     *int32
+	maxRunning  *int32
+	dependsOn   []string
+	// barrier, if any, holds Extract until every transform sharing it runs
+	barrier *sync.WaitGroup
+}
+
+type fakeExtraction struct {
+	transform fakeTransform
+}
+
+type fakeOutput struct {
+	transform fakeTransform
+}
+
+func (t fakeTransform) Extract() (Extraction, error) {
+	running := atomic.AddInt32(t.running, 1)
+	defer atomic.AddInt32(t.running, -1)
+
+	for {
+		max := atomic.LoadInt32(t.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(t.maxRunning, max, running) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	if t.barrier != nil {
+		t.barrier.Done()
+		t.barrier.Wait()
+	}
+
+	if t.extractErr != nil {
+		return nil, t.extractErr
+	}
+	return fakeExtraction{transform: t}, nil
+}
+
+func (t fakeTransform) Name() string {
+	return t.name
+}
+
+func (t fakeTransform) DependsOn() []string {
+	return t.dependsOn
+}
+
+func (e fakeExtraction) Transform() (Output, error) {
+	return fakeOutput{transform: e.transform}, nil
+}
+
+func (e fakeExtraction) Validate() error {
+	return e.transform.validateErr
+}
+
+func (o fakeOutput) Flush(writer Writer) error {
+	o.transform.flushMutex.Lock()
+	defer o.transform.flushMutex.Unlock()
+	*o.transform.flushed = append(*o.transform.flushed, o.transform.name)
+	return nil
+}
+
+func TestRunnerTransform(t *testing.T) {
+	testCases := []struct {
+		name            string
+		workers         int
+		delays          []time.Duration
+		extractErrs     []error
+		dependsOn       [][]string
+		expectedFlushed []string
+		expectedErrors  TransformErrors
+	}{
+		{
+			name:            "flush in order regardless of completion order",
+			workers:         3,
+			delays:          []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 0},
+			extractErrs:     []error{nil, nil, nil},
+			expectedFlushed: []string{"first", "second", "third"},
+		},
+		{
+			name:            "limit concurrency to workers",
+			workers:         1,
+			delays:          []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond},
+			extractErrs:     []error{nil, nil, nil},
+			expectedFlushed: []string{"first", "second", "third"},
+		},
+		{
+			name:            "aggregate errors per transform",
+			workers:         2,
+			delays:          []time.Duration{0, 0, 0},
+			extractErrs:     []error{errors.New("fetch failed"), nil, errors.New("decode failed")},
+			expectedFlushed: []string{"second"},
+			expectedErrors: TransformErrors{
+				{Transform: "first", Err: errors.New("fetch failed")},
+				{Transform: "third", Err: errors.New("decode failed")},
+			},
+		},
+		{
+			name:            "run prerequisites first",
+			workers:         3,
+			delays:          []time.Duration{0, 10 * time.Millisecond, 20 * time.Millisecond},
+			extractErrs:     []error{nil, nil, nil},
+			dependsOn:       [][]string{{"second"}, {"third"}, nil},
+			expectedFlushed: []string{"third", "second", "first"},
+		},
+		{
+			name:            "skip dependents of a failed transform",
+			workers:         3,
+			delays:          []time.Duration{0, 0, 0},
+			extractErrs:     []error{nil, errors.New("fetch failed"), nil},
+			dependsOn:       [][]string{{"second"}, nil, nil},
+			expectedFlushed: []string{"third"},
+			expectedErrors: TransformErrors{
+				{Transform: "second", Err: errors.New("fetch failed")},
+				{Transform: "first", Err: errors.New("prerequisite second failed")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				flushed             []string
+				flushMutex          sync.Mutex
+				running, maxRunning int32
+				transforms          []Transform
+			)
+
+			for i, name := range []string{"first", "second", "third"} {
+				var dependsOn []string
+				if tc.dependsOn != nil {
+					dependsOn = tc.dependsOn[i]
+				}
+
+				transforms = append(transforms, fakeTransform{
+					name:       name,
+					delay:      tc.delays[i],
+					extractErr: tc.extractErrs[i],
+					flushed:    &flushed,
+					flushMutex: &flushMutex,
+					running:    &running,
+					maxRunning: &maxRunning,
+					dependsOn:  dependsOn,
+				})
+			}
+
+			runner := Runner{Workers: tc.workers}
+			err := runner.Transform(transforms)
+			if tc.expectedErrors != nil {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErrors, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedFlushed, flushed)
+			assert.True(t, maxRunning <= int32(tc.workers))
+		})
+	}
+}
+
+func TestRunnerTransformConcurrently(t *testing.T) {
+	var flushed []string
+	var flushMutex sync.Mutex
+	var running, maxRunning int32
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+
+	var transforms []Transform
+	for _, name := range []string{"OAuth", "SDN"} {
+		transforms = append(transforms, fakeTransform{
+			name:       name,
+			flushed:    &flushed,
+			flushMutex: &flushMutex,
+			running:    &running,
+			maxRunning: &maxRunning,
+			barrier:    &barrier,
+		})
+	}
+
+	done := make(chan error)
+	go func() {
+		runner := Runner{Workers: 2}
+		done <- runner.Transform(transforms)
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("independent transforms did not run concurrently")
+	}
+	assert.ElementsMatch(t, []string{"OAuth", "SDN"}, flushed)
+	assert.Equal(t, int32(2), maxRunning)
+}
+
+func TestRunnerTransformFetchError(t *testing.T) {
+	var flushed []string
+	var flushMutex sync.Mutex
+	var running, maxRunning int32
+
+	fetchErr := &sftpclient.FetchError{
+		Kind: sftpclient.NetworkError,
+		Host: "master-0.test.example.com",
+		Path: "/etc/origin/master/master-config.yaml",
+		Err:  errors.New("connection refused"),
+	}
+
+	runner := Runner{Workers: 1}
+	err := runner.Transform([]Transform{fakeTransform{
+		name:       "OAuth",
+		extractErr: fetchErr,
+		flushed:    &flushed,
+		flushMutex: &flushMutex,
+		running:    &running,
+		maxRunning: &maxRunning,
+	}})
+	require.Error(t, err)
+
+	transformErrs, ok := err.(TransformErrors)
+	require.True(t, ok)
+	require.Len(t, transformErrs, 1)
+	assert.True(t, io.IsUnreachable(transformErrs[0]))
+	assert.False(t, io.IsNotFound(transformErrs[0]))
+}
+
+// versionedTransform is a fakeTransform supporting some source versions only
+type versionedTransform struct {
+	fakeTransform
+	versions config.VersionRange
+}
+
+func (t versionedTransform) SourceVersions() config.VersionRange {
+	return t.versions
+}
+
+func TestRunnerSourceVersion(t *testing.T) {
+	testCases := []struct {
+		name            string
+		version         config.Version
+		expectedFlushed []string
+		expectedErrors  TransformErrors
+	}{
+		{
+			name:            "run transforms supporting the source version",
+			version:         config.Version{Major: 3, Minor: 11},
+			expectedFlushed: []string{"any", "node-configmaps"},
+		},
+		{
+			name:            "skip transforms not supporting the source version",
+			version:         config.Version{Major: 3, Minor: 7},
+			expectedFlushed: []string{"any"},
+			expectedErrors: TransformErrors{
+				{Transform: "node-configmaps", Err: errors.New("source version 3.7 not supported, needs 3.10 or later")},
+			},
+		},
+		{
+			name:            "run every transform when the source version is unknown",
+			expectedFlushed: []string{"any", "node-configmaps"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var flushed []string
+			var flushMutex sync.Mutex
+			var running, maxRunning int32
+			newTransform := func(name string) fakeTransform {
+				return fakeTransform{
+					name:       name,
+					flushed:    &flushed,
+					flushMutex: &flushMutex,
+					running:    &running,
+					maxRunning: &maxRunning,
+				}
+			}
+
+			runner := Runner{Workers: 1, Version: tc.version}
+			err := runner.Transform([]Transform{
+				newTransform("any"),
+				versionedTransform{
+					fakeTransform: newTransform("node-configmaps"),
+					versions:      config.VersionRange{Min: config.Version{Major: 3, Minor: 10}},
+				},
+			})
+			if tc.expectedErrors != nil {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErrors, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedFlushed, flushed)
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	transforms := []Transform{
+		fakeTransform{name: "OAuth"},
+		fakeTransform{name: "SDN"},
+		fakeTransform{name: "Registries", dependsOn: []string{"SDN"}},
+		fakeTransform{name: "APIServer"},
+	}
+
+	testCases := []struct {
+		name          string
+		only          []string
+		skip          []string
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "all",
+			expected: []string{"OAuth", "SDN", "Registries", "APIServer"},
+		},
+		{
+			name:     "only, regardless of case",
+			only:     []string{"oauth", "APIServer"},
+			expected: []string{"OAuth", "APIServer"},
+		},
+		{
+			name:     "only with prerequisites",
+			only:     []string{"Registries"},
+			expected: []string{"SDN", "Registries"},
+		},
+		{
+			name:     "skip",
+			skip:     []string{"SDN", "APIServer"},
+			expected: []string{"OAuth", "Registries"},
+		},
+		{
+			name:     "only and skip",
+			only:     []string{"OAuth", "SDN"},
+			skip:     []string{"SDN"},
+			expected: []string{"OAuth"},
+		},
+		{
+			name:          "unknown transform",
+			only:          []string{"Proxy"},
+			expectedError: "unknown transform Proxy, run cpma transform list",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, err := Select(transforms, tc.only, tc.skip)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			var names []string
+			for _, transform := range selected {
+				names = append(names, transform.Name())
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestPrintTransforms(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, PrintTransforms(&buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, len(transforms(&config.Config{}))+1)
+	assert.Regexp(t, `^NAME\s+DESCRIPTION$`, lines[0])
+	assert.Regexp(t, `^OAuth\s+Migrates the identity providers`, lines[1])
+}
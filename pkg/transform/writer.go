@@ -0,0 +1,283 @@
+package transform
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/sirupsen/logrus"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DefaultOutputFormat writes a file per manifest
+const DefaultOutputFormat = "dir"
+
+// Writer writes the manifests the transforms flush, in the order they are
+// flushed, one transform at a time
+type Writer interface {
+	Write(manifests []Manifest) error
+	// Close completes the output once every transform is flushed
+	Close() error
+}
+
+// WriterOptions tells writers where to write
+type WriterOptions struct {
+	// OutputDir is the directory of the output files
+	OutputDir string
+	// Stdout is the destination of the stdout format
+	Stdout io.Writer
+	// Encrypter encrypts the files holding Secrets, nil to leave them clear.
+	// They are readable by their owner only either way.
+	Encrypter *encrypt.Encrypter
+}
+
+// NewWriterFunc creates a writer with options
+type NewWriterFunc func(options WriterOptions) (Writer, error)
+
+// writers are the writers of each output format
+var writers = map[string]NewWriterFunc{
+	DefaultOutputFormat: newDirWriter,
+	"yaml":              newYAMLWriter,
+	"list":              newListWriter,
+	"tar.gz":            newTarWriter,
+	"stdout":            newStdoutWriter,
+	"patch":             newPatchWriter,
+	"kustomize":         newKustomizeWriter,
+}
+
+// RegisterWriter adds or replaces the writer of an output format
+func RegisterWriter(format string, newWriter NewWriterFunc) {
+	writers[format] = newWriter
+}
+
+// OutputFormats returns the output formats, sorted
+func OutputFormats() []string {
+	formats := make([]string, 0, len(writers))
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// NewWriter creates the writer of an output format, DefaultOutputFormat if empty
+func NewWriter(format string, options WriterOptions) (Writer, error) {
+	if format == "" {
+		format = DefaultOutputFormat
+	}
+
+	newWriter, ok := writers[format]
+	if !ok {
+		return nil, errors.New("unknown output format " + format + ", use one of " + strings.Join(OutputFormats(), ", "))
+	}
+
+	return newWriter(options)
+}
+
+// dirWriter writes each manifest into a file of OutputDir/manifests
+type dirWriter struct {
+	dir       string
+	encrypter *encrypt.Encrypter
+}
+
+func newDirWriter(options WriterOptions) (Writer, error) {
+	return dirWriter{dir: filepath.Join(options.OutputDir, "manifests"), encrypter: options.Encrypter}, nil
+}
+
+func (w dirWriter) Write(manifests []Manifest) error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+
+	for _, manifest := range manifests {
+		maniftestfile := filepath.Join(w.dir, manifest.Name)
+		if isSecret(manifest) {
+			if err := encrypt.WriteFile(maniftestfile, manifest.CRD, w.encrypter); err != nil {
+				return err
+			}
+		} else if err := ioutil.WriteFile(maniftestfile, manifest.CRD, 0644); err != nil {
+			return err
+		}
+		logrus.Printf("CRD:Added: %s", maniftestfile)
+	}
+
+	return nil
+}
+
+func (w dirWriter) Close() error {
+	return nil
+}
+
+// bundleWriter collects the manifests of the run, which bundle writes at once
+// on Close
+type bundleWriter struct {
+	manifests []Manifest
+	bundle    func(manifests []Manifest) error
+}
+
+func (w *bundleWriter) Write(manifests []Manifest) error {
+	w.manifests = append(w.manifests, manifests...)
+	return nil
+}
+
+func (w *bundleWriter) Close() error {
+	return w.bundle(w.manifests)
+}
+
+// newYAMLWriter writes the manifests as documents of OutputDir/manifests.yaml
+func newYAMLWriter(options WriterOptions) (Writer, error) {
+	return &bundleWriter{bundle: func(manifests []Manifest) error {
+		return writeBundle(filepath.Join(options.OutputDir, "manifests.yaml"), yamlDocuments(manifests), manifests, options.Encrypter)
+	}}, nil
+}
+
+// newListWriter writes the manifests as items of a v1/List in
+// OutputDir/manifests.json
+func newListWriter(options WriterOptions) (Writer, error) {
+	return &bundleWriter{bundle: func(manifests []Manifest) error {
+		list := struct {
+			APIVersion string            `json:"apiVersion"`
+			Kind       string            `json:"kind"`
+			Items      []json.RawMessage `json:"items"`
+		}{APIVersion: "v1", Kind: "List", Items: []json.RawMessage{}}
+
+		for _, manifest := range manifests {
+			item, err := k8syaml.ToJSON(manifest.CRD)
+			if err != nil {
+				return errors.New(manifest.Name + ": " + err.Error())
+			}
+			list.Items = append(list.Items, item)
+		}
+
+		content, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		return writeBundle(filepath.Join(options.OutputDir, "manifests.json"), append(content, '\n'), manifests, options.Encrypter)
+	}}, nil
+}
+
+// newTarWriter writes the manifests as files of the manifests directory of
+// OutputDir/manifests.tar.gz
+func newTarWriter(options WriterOptions) (Writer, error) {
+	return &bundleWriter{bundle: func(manifests []Manifest) error {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+
+		now := time.Now()
+		for _, manifest := range manifests {
+			header := &tar.Header{
+				Name:    "manifests/" + manifest.Name,
+				Mode:    0644,
+				Size:    int64(len(manifest.CRD)),
+				ModTime: now,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(manifest.CRD); err != nil {
+				return err
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		return writeBundle(filepath.Join(options.OutputDir, "manifests.tar.gz"), buf.Bytes(), manifests, options.Encrypter)
+	}}, nil
+}
+
+// stdoutWriter writes the manifests as YAML documents to Stdout as they are
+// flushed
+type stdoutWriter struct {
+	out io.Writer
+}
+
+func newStdoutWriter(options WriterOptions) (Writer, error) {
+	if options.Stdout == nil {
+		return nil, errors.New("no standard output to write to")
+	}
+	if options.Encrypter != nil {
+		return nil, errors.New("secrets cannot be encrypted on the standard output, use another output format")
+	}
+
+	return stdoutWriter{out: options.Stdout}, nil
+}
+
+func (w stdoutWriter) Write(manifests []Manifest) error {
+	_, err := w.out.Write(yamlDocuments(manifests))
+	return err
+}
+
+func (w stdoutWriter) Close() error {
+	return nil
+}
+
+// yamlDocuments returns the manifests as YAML documents, each one starting
+// with a separator
+func yamlDocuments(manifests []Manifest) []byte {
+	var buf bytes.Buffer
+	for _, manifest := range manifests {
+		buf.WriteString("---\n")
+		buf.Write(manifest.CRD)
+		if !bytes.HasSuffix(manifest.CRD, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// isSecret tells manifest is a Secret, whose files are written with
+// encrypt.WriteFile
+func isSecret(manifest Manifest) bool {
+	content, err := k8syaml.ToJSON(manifest.CRD)
+	if err != nil {
+		return false
+	}
+
+	var object struct {
+		Kind string `json:"kind"`
+	}
+	return json.Unmarshal(content, &object) == nil && object.Kind == "Secret"
+}
+
+// writeBundle writes the bundle of manifests to file, as a secret if one of
+// them is a Secret
+func writeBundle(file string, content []byte, manifests []Manifest, encrypter *encrypt.Encrypter) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	secret := false
+	for _, manifest := range manifests {
+		secret = secret || isSecret(manifest)
+	}
+	if secret {
+		if err := encrypt.WriteFile(file, content, encrypter); err != nil {
+			return err
+		}
+	} else if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+	logrus.Printf("Bundle:Added: %s", file)
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fusor/cpma/pkg/encrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writerFunc is a Writer calling itself on Write
+type writerFunc func(manifests []Manifest) error
+
+func (f writerFunc) Write(manifests []Manifest) error {
+	return f(manifests)
+}
+
+func (f writerFunc) Close() error {
+	return nil
+}
+
+var writerTestManifests = [][]Manifest{
+	{
+		{Name: "100_CPMA-cluster-config-oauth.yaml", CRD: []byte("apiVersion: config.openshift.io/v1\nkind: OAuth\nmetadata:\n  name: cluster\n")},
+	},
+	{
+		{Name: "100_CPMA-cluster-config-sdn.yaml", CRD: []byte("apiVersion: operator.openshift.io/v1\nkind: Network\nspec:\n  serviceNetwork: 172.30.0.0/16")},
+	},
+}
+
+func writeTestManifests(t *testing.T, format string, options WriterOptions) {
+	writer, err := NewWriter(format, options)
+	require.NoError(t, err)
+	for _, manifests := range writerTestManifests {
+		require.NoError(t, writer.Write(manifests))
+	}
+	require.NoError(t, writer.Close())
+}
+
+func TestWriters(t *testing.T) {
+	expectedYAML := `---
+apiVersion: config.openshift.io/v1
+kind: OAuth
+metadata:
+  name: cluster
+---
+apiVersion: operator.openshift.io/v1
+kind: Network
+spec:
+  serviceNetwork: 172.30.0.0/16
+`
+
+	testCases := []struct {
+		name            string
+		format          string
+		expectedFile    string
+		expectedContent string
+	}{
+		{
+			name:            "dir",
+			format:          "",
+			expectedFile:    "manifests/100_CPMA-cluster-config-oauth.yaml",
+			expectedContent: string(writerTestManifests[0][0].CRD),
+		},
+		{
+			name:            "multi-document yaml",
+			format:          "yaml",
+			expectedFile:    "manifests.yaml",
+			expectedContent: expectedYAML,
+		},
+		{
+			name:         "v1 list",
+			format:       "list",
+			expectedFile: "manifests.json",
+			expectedContent: `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "apiVersion": "config.openshift.io/v1",
+      "kind": "OAuth",
+      "metadata": {
+        "name": "cluster"
+      }
+    },
+    {
+      "apiVersion": "operator.openshift.io/v1",
+      "kind": "Network",
+      "spec": {
+        "serviceNetwork": "172.30.0.0/16"
+      }
+    }
+  ]
+}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "cpma-writer")
+			require.NoError(t, err)
+			defer os.RemoveAll(outputDir)
+
+			writeTestManifests(t, tc.format, WriterOptions{OutputDir: outputDir})
+
+			content, err := ioutil.ReadFile(filepath.Join(outputDir, tc.expectedFile))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedContent, string(content))
+		})
+	}
+
+	t.Run("stdout", func(t *testing.T) {
+		var out strings.Builder
+		writeTestManifests(t, "stdout", WriterOptions{Stdout: &out})
+		assert.Equal(t, expectedYAML, out.String())
+	})
+}
+
+func TestTarWriter(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-writer")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	writeTestManifests(t, "tar.gz", WriterOptions{OutputDir: outputDir})
+
+	file, err := os.Open(filepath.Join(outputDir, "manifests.tar.gz"))
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	for _, manifests := range writerTestManifests {
+		header, err := tr.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "manifests/"+manifests[0].Name, header.Name)
+		content, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		assert.Equal(t, manifests[0].CRD, content)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	_, err := NewWriter("xml", WriterOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown output format xml, use one of dir, kustomize, list, patch, stdout, tar.gz, yaml")
+}
+
+func TestWritersProtectSecrets(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "cpma-writer")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	secret := Manifest{
+		Name: "100_CPMA-cluster-config-secret-htpasswd_auth-secret.yaml",
+		CRD:  []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: htpasswd_auth-secret\ndata:\n  htpasswd: dXNlcjpwYXNzd29yZA==\n"),
+	}
+	manifests := append([]Manifest{secret}, writerTestManifests[0]...)
+
+	for _, format := range []string{"dir", "yaml"} {
+		writer, err := NewWriter(format, WriterOptions{OutputDir: outputDir})
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(manifests))
+		require.NoError(t, writer.Close())
+	}
+
+	for file, mode := range map[string]os.FileMode{
+		"manifests/" + secret.Name: 0600,
+		"manifests.yaml":           0600,
+	} {
+		info, err := os.Stat(filepath.Join(outputDir, file))
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), file)
+	}
+
+	_, err = NewWriter("stdout", WriterOptions{Stdout: os.Stdout, Encrypter: &encrypt.Encrypter{}})
+	assert.Error(t, err)
+}